@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type BenchmarkCase struct {
+	Input    string `json:"input"`
+	Expected string `json:"expected"`
+}
+
+type BenchmarkModel struct {
+	Provider string
+	Name     string
+}
+
+type PromptVariant struct {
+	Name   string
+	System string
+}
+
+type BenchmarkScore struct {
+	Model      BenchmarkModel
+	Prompt     string
+	Cases      int
+	Errors     int
+	ExactMatch int
+	SpanF1     float64
+	Latency    time.Duration
+}
+
+var tokenRegexp = regexp.MustCompile(`[\p{L}\p{N}]+|[^\s\p{L}\p{N}]`)
+
+func runBenchmark(datasetPath string, models string, promptsDir string) {
+	cases, err := readBenchmarkCases(datasetPath)
+	if err != nil {
+		log.Fatalln("could not read benchmark dataset", err)
+	}
+	prompts, err := readPromptVariants(promptsDir)
+	if err != nil {
+		log.Fatalln("could not read prompt variants", err)
+	}
+
+	ctx := context.Background()
+	openaiClient := openai.NewClient(option.WithAPIKey(os.Getenv("OPENAI_API_KEY")))
+	ollamaHost := os.Getenv("OLLAMA_HOST")
+
+	var scores []BenchmarkScore
+	for _, model := range parseBenchmarkModels(models) {
+		for _, prompt := range prompts {
+			score := BenchmarkScore{Model: model, Prompt: prompt.Name}
+			for i, c := range cases {
+				start := time.Now()
+				censored, err := censorWith(ctx, model, prompt, c.Input, ollamaHost, openaiClient)
+				score.Cases++
+				if err != nil {
+					log.Printf("case %d failed for %s:%s (%s): %v", i+1, model.Provider, model.Name, prompt.Name, err)
+					score.Errors++
+					continue
+				}
+				score.Latency += time.Since(start)
+				if normalizeSentence(censored) == normalizeSentence(c.Expected) {
+					score.ExactMatch++
+				}
+				score.SpanF1 += spanF1(c.Input, c.Expected, censored)
+			}
+			scores = append(scores, score)
+		}
+	}
+
+	printRanking(scores)
+}
+
+func censorWith(ctx context.Context, model BenchmarkModel, prompt PromptVariant, input string, ollamaHost string, client *openai.Client) (string, error) {
+	switch model.Provider {
+	case "ollama":
+		resp, err := callOllama(ollamaHost, Request{
+			Model:    model.Name,
+			Stream:   false,
+			Messages: []Message{{Role: "system", Content: prompt.System}, prepareUserMessage(input)},
+		})
+		if err != nil {
+			return "", err
+		}
+		return resp.Message.Content, nil
+	case "openai":
+		resp, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
+				openai.ChatCompletionMessageParam{
+					Role:    openai.F(openai.ChatCompletionMessageParamRole("system")),
+					Content: openai.F[interface{}](prompt.System),
+				},
+				openai.ChatCompletionMessageParam{
+					Role:    openai.F(openai.ChatCompletionMessageParamRole("user")),
+					Content: openai.F[interface{}](input),
+				},
+			}),
+			Model:       openai.F(model.Name),
+			Temperature: openai.F[float64](0),
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			return "", fmt.Errorf("no choices in the response of %s", model.Name)
+		}
+		return resp.Choices[0].Message.Content, nil
+	default:
+		return "", fmt.Errorf("unknown provider %s", model.Provider)
+	}
+}
+
+func readBenchmarkCases(path string) ([]BenchmarkCase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var cases []BenchmarkCase
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var c BenchmarkCase
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		cases = append(cases, c)
+	}
+	return cases, scanner.Err()
+}
+
+// readPromptVariants always includes the production prompt as "default", every
+// *.txt file from dir is added as an extra variant named after the file.
+func readPromptVariants(dir string) ([]PromptVariant, error) {
+	prompts := []PromptVariant{{Name: "default", System: prepareSystemMessage().Content}}
+	if dir == "" {
+		return prompts, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, PromptVariant{
+			Name:   strings.TrimSuffix(filepath.Base(file), ".txt"),
+			System: strings.TrimSpace(string(content)),
+		})
+	}
+	return prompts, nil
+}
+
+// parseBenchmarkModels reads a comma separated list of provider:model entries,
+// entries without a provider are treated as Ollama models.
+func parseBenchmarkModels(models string) []BenchmarkModel {
+	var parsed []BenchmarkModel
+	for _, entry := range strings.Split(models, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		provider, name, found := strings.Cut(entry, ":")
+		if !found || (provider != "ollama" && provider != "openai") {
+			provider, name = "ollama", entry
+		}
+		parsed = append(parsed, BenchmarkModel{Provider: provider, Name: name})
+	}
+	return parsed
+}
+
+func normalizeSentence(sentence string) string {
+	return strings.Join(strings.Fields(sentence), " ")
+}
+
+// spanF1 compares the spans of the input which were replaced in the expected
+// output with the spans replaced in the actual output.
+func spanF1(input string, expected string, actual string) float64 {
+	expectedSpans := censoredSpans(input, expected)
+	actualSpans := censoredSpans(input, actual)
+	if len(expectedSpans) == 0 && len(actualSpans) == 0 {
+		return 1
+	}
+
+	matched := 0
+	for _, span := range actualSpans {
+		if slices.Contains(expectedSpans, span) {
+			matched++
+		}
+	}
+	if matched == 0 {
+		return 0
+	}
+	precision := float64(matched) / float64(len(actualSpans))
+	recall := float64(matched) / float64(len(expectedSpans))
+	return 2 * precision * recall / (precision + recall)
+}
+
+// censoredSpans returns [start, end) token ranges of the input which are not
+// kept in the output, based on the longest common subsequence of the tokens.
+func censoredSpans(input string, output string) [][2]int {
+	in := tokenRegexp.FindAllString(input, -1)
+	out := tokenRegexp.FindAllString(output, -1)
+
+	lcs := make([][]int, len(in)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(out)+1)
+	}
+	for i := len(in) - 1; i >= 0; i-- {
+		for j := len(out) - 1; j >= 0; j-- {
+			if in[i] == out[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var spans [][2]int
+	start := -1
+	for i, j := 0, 0; i < len(in); {
+		if j < len(out) && in[i] == out[j] {
+			if start >= 0 {
+				spans = append(spans, [2]int{start, i})
+				start = -1
+			}
+			i++
+			j++
+		} else if j < len(out) && lcs[i][j+1] >= lcs[i+1][j] {
+			j++
+		} else {
+			if start < 0 {
+				start = i
+			}
+			i++
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(in)})
+	}
+	return spans
+}
+
+func printRanking(scores []BenchmarkScore) {
+	slices.SortStableFunc(scores, func(a, b BenchmarkScore) int {
+		if c := cmp.Compare(b.meanSpanF1(), a.meanSpanF1()); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.ExactMatch, a.ExactMatch); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.meanLatency(), b.meanLatency())
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tPROVIDER\tMODEL\tPROMPT\tEXACT\tSPAN F1\tLATENCY\tERRORS")
+	for i, s := range scores {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d/%d\t%.3f\t%s\t%d\n",
+			i+1, s.Model.Provider, s.Model.Name, s.Prompt, s.ExactMatch, s.Cases, s.meanSpanF1(), s.meanLatency().Round(time.Millisecond), s.Errors)
+	}
+	w.Flush()
+}
+
+func (s BenchmarkScore) meanSpanF1() float64 {
+	if s.Cases == 0 {
+		return 0
+	}
+	return s.SpanF1 / float64(s.Cases)
+}
+
+func (s BenchmarkScore) meanLatency() time.Duration {
+	answered := s.Cases - s.Errors
+	if answered == 0 {
+		return 0
+	}
+	return s.Latency / time.Duration(answered)
+}
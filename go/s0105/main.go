@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
 	"io"
@@ -43,10 +44,20 @@ type Response struct {
 }
 
 func main() {
+	benchmark := flag.String("benchmark", "", "path to JSONL dataset with input and expected censored sentences")
+	models := flag.String("models", "ollama:SpeakLeash/bielik-11b-v2.2-instruct:Q4_K_M", "comma separated provider:model list used by the benchmark")
+	prompts := flag.String("prompts", "", "directory with additional system prompt variants (*.txt) used by the benchmark")
+	flag.Parse()
+
 	err := godotenv.Load("../../.env")
 	if err != nil {
 		log.Fatalln("could not load env variables", err)
 	}
+
+	if *benchmark != "" {
+		runBenchmark(*benchmark, *models, *prompts)
+		return
+	}
 	ollamaHost := os.Getenv("OLLAMA_HOST")
 	centralaHost := os.Getenv("CENTRALA_HOST")
 	apiKey := os.Getenv("AI_DEVS_API_KEY")
@@ -66,6 +77,7 @@ func main() {
 	if err != nil {
 		log.Fatalln("calling ollama failed", err)
 	}
+	fmt.Println(resp.Message.Content)
 
 	err = sendFinalAnswer(centralaHost, apiKey, resp.Message.Content)
 	if err != nil {
@@ -88,10 +100,13 @@ func callOllama(ollamaHost string, ollamaReq Request) (*Response, error) {
 		return nil, err
 	}
 	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(httpResp.Body)
+		return nil, fmt.Errorf("bad status: %s %s", httpResp.Status, string(body))
+	}
 
 	ollamaResp := Response{}
 	err = json.NewDecoder(httpResp.Body).Decode(&ollamaResp)
-	fmt.Println(ollamaResp.Message.Content)
 	return &ollamaResp, err
 }
 
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/openai/openai-go"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type CityCandidate struct {
+	City       string  `json:"city"`
+	Confidence float64 `json:"confidence"`
+	Reason     string  `json:"reason"`
+}
+
+type FragmentDescription struct {
+	Path            string          `json:"path"`
+	StreetNames     []string        `json:"street_names"`
+	Landmarks       []string        `json:"landmarks"`
+	Numbers         []string        `json:"numbers"`
+	Features        string          `json:"features"`
+	CandidateCities []CityCandidate `json:"candidate_cities"`
+}
+
+type CityCluster struct {
+	City      string
+	Score     float64
+	Fragments []string
+}
+
+type AggregatedAnswer struct {
+	City      string
+	Clusters  []CityCluster
+	Outliers  []string
+	Reasoning string
+}
+
+// resolveImagePaths accepts a directory (all images inside are taken) or a glob pattern.
+func resolveImagePaths(pattern string) ([]string, error) {
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*")
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid images pattern %s: %v", pattern, err)
+	}
+
+	var paths []string
+	for _, match := range matches {
+		switch strings.ToLower(filepath.Ext(match)) {
+		case ".png", ".jpg", ".jpeg", ".webp", ".gif":
+			paths = append(paths, match)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no images found for %s", pattern)
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+func describeFragment(ctx context.Context, client *openai.Client, path string, tileSize int, settings ModelSettings) (*FragmentDescription, error) {
+	imageMsg, err := prepareImageUserMessage(path, tileSize)
+	if err != nil {
+		return nil, err
+	}
+	answer, err := callModelForAnswer(ctx, client, []openai.ChatCompletionMessageParamUnion{prepareSystemMessage(), *imageMsg}, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var fragment FragmentDescription
+	if err := json.Unmarshal([]byte(answer), &fragment); err != nil {
+		return nil, fmt.Errorf("could not parse description of %s: %v", path, err)
+	}
+	fragment.Path = path
+	return &fragment, nil
+}
+
+// aggregateFragments clusters the fragments by their most probable city and picks
+// the city with the highest confidence weighted vote. Fragments which do not
+// support the winning city at all are reported as outliers.
+func aggregateFragments(fragments []FragmentDescription) AggregatedAnswer {
+	scores := make(map[string]float64)
+	names := make(map[string]string)
+	clusters := make(map[string][]string)
+
+	for _, fragment := range fragments {
+		for i, candidate := range fragment.CandidateCities {
+			key := normalizeCity(candidate.City)
+			if key == "" {
+				continue
+			}
+			if _, ok := names[key]; !ok {
+				names[key] = strings.TrimSpace(candidate.City)
+			}
+			scores[key] += candidate.Confidence
+			if i == 0 {
+				clusters[key] = append(clusters[key], fragment.Path)
+			}
+		}
+	}
+
+	var result AggregatedAnswer
+	for key, score := range scores {
+		result.Clusters = append(result.Clusters, CityCluster{City: names[key], Score: score, Fragments: clusters[key]})
+	}
+	slices.SortFunc(result.Clusters, func(a, b CityCluster) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.City, b.City)
+	})
+	if len(result.Clusters) == 0 {
+		result.Reasoning = "no fragment contained any candidate city"
+		return result
+	}
+
+	winner := result.Clusters[0]
+	result.City = winner.City
+
+	var reasoning []string
+	for _, fragment := range fragments {
+		support := 0.0
+		for _, candidate := range fragment.CandidateCities {
+			if normalizeCity(candidate.City) == normalizeCity(winner.City) {
+				support = candidate.Confidence
+				reasoning = append(reasoning, fmt.Sprintf("%s supports %s (%.2f): %s", filepath.Base(fragment.Path), winner.City, support, candidate.Reason))
+				break
+			}
+		}
+		if support == 0 {
+			result.Outliers = append(result.Outliers, fragment.Path)
+			reasoning = append(reasoning, fmt.Sprintf("%s is an outlier, streets %v point to %s", filepath.Base(fragment.Path), fragment.StreetNames, topCandidate(fragment)))
+		}
+	}
+	reasoning = append(reasoning, fmt.Sprintf("%s won with weighted score %.2f out of %d clusters", winner.City, winner.Score, len(result.Clusters)))
+	result.Reasoning = strings.Join(reasoning, "; ")
+	return result
+}
+
+func topCandidate(fragment FragmentDescription) string {
+	if len(fragment.CandidateCities) == 0 {
+		return "unknown city"
+	}
+	return fragment.CandidateCities[0].City
+}
+
+func normalizeCity(city string) string {
+	return strings.ToLower(strings.TrimSpace(city))
+}
@@ -5,6 +5,7 @@ go 1.23.2
 require (
 	github.com/joho/godotenv v1.5.1
 	github.com/openai/openai-go v0.1.0-alpha.43
+	shared v0.0.0-00010101000000-000000000000
 )
 
 require (
@@ -12,4 +13,7 @@ require (
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
+	golang.org/x/image v0.25.0 // indirect
 )
+
+replace shared => ../shared
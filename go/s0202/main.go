@@ -3,84 +3,166 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
 	"log"
+	"math/rand"
 	"os"
+	"shared/consensus"
+	"shared/media"
+	"slices"
+	"strings"
 )
 
+type ModelSettings struct {
+	Model       openai.ChatModel
+	Temperature float64
+}
+
 func main() {
+	images := flag.String("images", "../../images", "directory or glob pattern with the map fragments")
+	tileSize := flag.Int("tile", 0, "split images bigger than the given size (px) into tiles, 0 disables tiling")
+	samples := flag.Int("samples", 1, "number of pipeline runs used for self-consistency voting")
+	minConfidence := flag.Float64("min-confidence", 0.6, "share of votes required to accept the majority city")
+	escalateModel := flag.String("escalate-model", openai.ChatModelO1, "model used when voting gives no clear winner")
+	flag.Parse()
+
 	ctx := context.Background()
 	err := godotenv.Load("../../.env")
 	if err != nil {
 		log.Fatalf("could not load env variables %v", err)
 	}
 
-	paths := []string{
-		"../../images/image01.png",
-		"../../images/image02.png",
-		"../../images/image03.png",
-		"../../images/image04.png",
+	paths, err := resolveImagePaths(*images)
+	if err != nil {
+		log.Fatalln(err)
 	}
 
 	openaiClient := openai.NewClient(option.WithAPIKey(os.Getenv("OPENAI_API_KEY")))
+	defaultSettings := ModelSettings{Model: openai.ChatModelGPT4o, Temperature: 0}
 
-	systemMsg := prepareSystemMessage()
-	messages := []openai.ChatCompletionMessageParamUnion{systemMsg}
-
-	for _, path := range paths {
-		msg, err := prepareImageUserMessage(path)
+	if *samples <= 1 {
+		result, err := runPipeline(ctx, openaiClient, paths, *tileSize, defaultSettings)
 		if err != nil {
 			log.Fatalln(err)
 		}
-		messages = append(messages, *msg)
+		log.Printf("final response is: %s", result.City)
+		return
 	}
 
-	answer, err := callModelForAnswer(ctx, openaiClient, messages)
+	vote, err := consensus.Vote(ctx, func(ctx context.Context, sample consensus.Sample) (string, error) {
+		shuffled := slices.Clone(paths)
+		rand.New(rand.NewSource(int64(sample.Index))).Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+		result, err := runPipeline(ctx, openaiClient, shuffled, *tileSize, ModelSettings{Model: defaultSettings.Model, Temperature: sample.Temperature})
+		if err != nil {
+			return "", err
+		}
+		return result.City, nil
+	}, consensus.Options{
+		Samples:       *samples,
+		Temperatures:  []float64{0, 0.4, 0.8},
+		MinConfidence: *minConfidence,
+		Escalate: func(ctx context.Context, sample consensus.Sample) (string, error) {
+			log.Printf("no clear winner, escalating to %s", *escalateModel)
+			result, err := runPipeline(ctx, openaiClient, paths, *tileSize, ModelSettings{Model: *escalateModel})
+			if err != nil {
+				return "", err
+			}
+			return result.City, nil
+		},
+	})
 	if err != nil {
-		log.Fatalln("error while calling openai", err)
+		log.Fatalln(err)
+	}
+	log.Printf("votes: %v, escalated: %t", vote.Votes, vote.Escalated)
+	log.Printf("final response is: %s (confidence %.2f)", vote.Answer, vote.Confidence)
+}
+
+func runPipeline(ctx context.Context, client *openai.Client, paths []string, tileSize int, settings ModelSettings) (*AggregatedAnswer, error) {
+	var fragments []FragmentDescription
+	for _, path := range paths {
+		fragment, err := describeFragment(ctx, client, path, tileSize, settings)
+		if err != nil {
+			return nil, fmt.Errorf("error while describing fragment %s: %v", path, err)
+		}
+		log.Printf("fragment %s -> streets: %v, landmarks: %v, candidates: %v", path, fragment.StreetNames, fragment.Landmarks, fragment.CandidateCities)
+		fragments = append(fragments, *fragment)
 	}
-	log.Printf("final response is: %s", answer)
+
+	result := aggregateFragments(fragments)
+	log.Printf("outliers: %v", result.Outliers)
+	log.Printf("reasoning: %s", result.Reasoning)
+	return &result, nil
 }
 
 func prepareSystemMessage() openai.ChatCompletionMessageParam {
 	return openai.ChatCompletionMessageParam{
 		Role: openai.F(openai.ChatCompletionMessageParamRole("system")),
 		Content: openai.F[interface{}]("You are an expert at Polish geography, topography, architecture and history.\n " +
-			"You are looking at different parts of a map of a city in Poland. It's not \"Toruń\" and it's not \"Kalisz\" and it's not \"Bydgoszcz\".\n " +
+			"You are looking at one part of a map of a city in Poland. It's not \"Toruń\" and it's not \"Kalisz\" and it's not \"Bydgoszcz\".\n " +
 			"There used to be \"spichlerze i twierdze\" in the city. Some maps contain street numbers - pay special attention to them. \n  " +
-			"Warning: one of the parts shows a map of a different city.\n Based on the geographical features, street layouts, and any visible landmarks, can you identify which city this is?  " +
-			"Please provide your reasoning."),
+			"Warning: the part may show a map of a different city than the other parts.\n " +
+			"Describe only what is visible on the map and respond with JSON object: " +
+			"{\"street_names\": [\"...\"], \"landmarks\": [\"...\"], \"numbers\": [\"...\"], \"features\": \"short description of the layout\", " +
+			"\"candidate_cities\": [{\"city\": \"...\", \"confidence\": 0.0-1.0, \"reason\": \"...\"}]}. " +
+			"List at most three candidate cities which contain all visible streets and landmarks, the most probable first."),
 	}
 }
 
-func prepareImageUserMessage(imagePath string) (*openai.ChatCompletionMessageParam, error) {
+func prepareImageUserMessage(imagePath string, tileSize int) (*openai.ChatCompletionMessageParam, error) {
 	fileContent, err := os.ReadFile(imagePath)
 	if err != nil {
 		return nil, fmt.Errorf("something went wrong while reading file %s", imagePath)
 	}
-	encoded := base64.StdEncoding.EncodeToString(fileContent)
-	iamgeUrl := openai.ChatCompletionContentPartImageImageURLParam{
-		URL:    openai.F[string](fmt.Sprintf("data:image/png;base64,%s", encoded)),
-		Detail: openai.F[openai.ChatCompletionContentPartImageImageURLDetail](openai.ChatCompletionContentPartImageImageURLDetailHigh),
+	img, err := media.PrepareImage(fileContent, media.OpenAILimits)
+	if err != nil {
+		return nil, fmt.Errorf("could not prepare image %s: %v", imagePath, err)
 	}
-	return &openai.ChatCompletionMessageParam{
-		Role: openai.F(openai.ChatCompletionMessageParamRole("user")),
-		Content: openai.F[interface{}]([]openai.ChatCompletionContentPartImageParam{openai.ChatCompletionContentPartImageParam{
+	tiles, err := media.Tile(img, tileSize)
+	if err != nil {
+		return nil, fmt.Errorf("could not tile image %s: %v", imagePath, err)
+	}
+
+	var parts []openai.ChatCompletionContentPartImageParam
+	estimatedTokens := 0
+	for _, tile := range tiles {
+		estimatedTokens += media.OpenAILimits.EstimateTokens(tile.Width, tile.Height)
+		encoded := base64.StdEncoding.EncodeToString(tile.Data)
+		imageUrl := openai.ChatCompletionContentPartImageImageURLParam{
+			URL:    openai.F[string](fmt.Sprintf("data:%s;base64,%s", tile.MIME, encoded)),
+			Detail: openai.F[openai.ChatCompletionContentPartImageImageURLDetail](openai.ChatCompletionContentPartImageImageURLDetailHigh),
+		}
+		parts = append(parts, openai.ChatCompletionContentPartImageParam{
 			Type:     openai.F[openai.ChatCompletionContentPartImageType](openai.ChatCompletionContentPartImageType(openai.ChatCompletionContentPartTypeImageURL)),
-			ImageURL: openai.F[openai.ChatCompletionContentPartImageImageURLParam](iamgeUrl),
-		}}),
+			ImageURL: openai.F[openai.ChatCompletionContentPartImageImageURLParam](imageUrl),
+		})
+	}
+	log.Printf("image %s sent as %s %dx%d in %d part(s), estimated %d tokens", imagePath, img.MIME, img.Width, img.Height, len(tiles), estimatedTokens)
+
+	return &openai.ChatCompletionMessageParam{
+		Role:    openai.F(openai.ChatCompletionMessageParamRole("user")),
+		Content: openai.F[interface{}](parts),
 	}, nil
 }
 
-func callModelForAnswer(ctx context.Context, client *openai.Client, messages []openai.ChatCompletionMessageParamUnion) (string, error) {
-	chatCompletion, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages:    openai.F(messages),
-		Model:       openai.F(openai.ChatModelGPT4o),
-		Temperature: openai.F[float64](0),
-	})
+func callModelForAnswer(ctx context.Context, client *openai.Client, messages []openai.ChatCompletionMessageParamUnion, settings ModelSettings) (string, error) {
+	params := openai.ChatCompletionNewParams{
+		Messages: openai.F(messages),
+		Model:    openai.F(settings.Model),
+		ResponseFormat: openai.F[openai.ChatCompletionNewParamsResponseFormatUnion](openai.ChatCompletionNewParamsResponseFormat{
+			Type: openai.F(openai.ChatCompletionNewParamsResponseFormatTypeJSONObject),
+		}),
+	}
+	// reasoning models accept only the default temperature
+	if !strings.HasPrefix(settings.Model, "o1") && !strings.HasPrefix(settings.Model, "o3") {
+		params.Temperature = openai.F(settings.Temperature)
+	}
+	chatCompletion, err := client.Chat.Completions.New(ctx, params)
 
 	if err != nil {
 		return "", err
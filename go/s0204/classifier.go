@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/generative-ai-go/genai"
+	"log"
+	"os"
+	"shared/batch"
+	"shared/gemini"
+	"shared/ingest"
+	"shared/review"
+	"shared/transcribe"
+	"slices"
+	"strings"
+)
+
+const maxAttempts = 2
+
+type Category struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+var defaultCategories = []Category{
+	{Name: "PEOPLE", Description: "the note contains information about captured people or traced of their presence"},
+	{Name: "HARDWARE", Description: "the note contains information only about the repaired hardware faults, software issues should not be included to this category"},
+	{Name: "UNKNOWN", Description: "the file can not be assigned to any other category"},
+}
+
+type Decision struct {
+	Category    string  `json:"category"`
+	Confidence  float64 `json:"confidence"`
+	Evidence    string  `json:"evidence"`
+	NeedsReview bool    `json:"needs_review,omitempty"`
+}
+
+type Classifier struct {
+	client        *genai.Client
+	limiter       *batch.Limiter
+	checkpoint    *batch.Checkpoint
+	preprocessor  *transcribe.Preprocessor
+	categories    []Category
+	minConfidence float64
+	review        *review.Store
+}
+
+func loadCategories(path string) ([]Category, error) {
+	if path == "" {
+		return defaultCategories, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var categories []Category
+	if err := json.Unmarshal(content, &categories); err != nil {
+		return nil, fmt.Errorf("could not parse categories %s: %v", path, err)
+	}
+	if len(categories) == 0 {
+		return nil, fmt.Errorf("no categories defined in %s", path)
+	}
+	return categories, nil
+}
+
+// checkpointContent appends the categories and the media mode to the file
+// content, they are part of the prompt, so a change of them invalidates the
+// decision.
+func (c *Classifier) checkpointContent(fileContent []byte) []byte {
+	categories, _ := json.Marshal(c.categories)
+	content := append(slices.Clone(fileContent), categories...)
+	return fmt.Appendf(content, "\npreprocessed: %t", c.preprocessor != nil)
+}
+
+func (c *Classifier) classify(ctx context.Context, file os.DirEntry) (*Decision, error) {
+	path := fmt.Sprintf("%s/%s", rootDir, file.Name())
+	fileContent, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if reviewed, ok := c.review.Decision(path, batch.ContentHash(fileContent)); ok {
+		return &Decision{Category: reviewed.Label, Confidence: 1, Evidence: "human review"}, nil
+	}
+
+	checkpointContent := c.checkpointContent(fileContent)
+	var decision Decision
+	if found, err := c.checkpoint.Lookup(path, checkpointContent, &decision); err != nil {
+		log.Printf("warning: ignoring checkpoint of %s: %v", file.Name(), err)
+	} else if found {
+		log.Printf("file %s already classified, skipping", file.Name())
+		return &decision, nil
+	}
+
+	requestContent := []genai.Part{genai.Text(file.Name())}
+	var texts []string
+	text, preprocessed := "", false
+	if c.preprocessor != nil {
+		text, preprocessed, err = c.preprocessor.Text(ctx, path, fileContent)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if preprocessed {
+		texts = append(texts, text)
+		requestContent = append(requestContent, genai.Text(text))
+	} else {
+		parts, err := registry.Parts(file.Name(), fileContent)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range parts {
+			if part.Kind == ingest.KindText {
+				texts = append(texts, part.Text)
+			}
+		}
+		requestContent = append(requestContent, gemini.Parts(file.Name(), parts)...)
+	}
+	requestContent = append(requestContent, c.preparePrompt())
+
+	var reason string
+	var suggestion *Decision
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err := c.limiter.Wait(ctx, "gemini"); err != nil {
+			return nil, err
+		}
+		answer, err := callModel(requestContent, c.responseSchema(), ctx, c.client)
+		if err != nil {
+			return nil, err
+		}
+		suggestion, err = c.parseDecision(answer, texts)
+		if err == nil && suggestion.Confidence >= c.minConfidence {
+			if err := c.checkpoint.Save(path, checkpointContent, suggestion); err != nil {
+				log.Printf("warning: %v", err)
+			}
+			return suggestion, nil
+		}
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = fmt.Sprintf("confidence %.2f below %.2f", suggestion.Confidence, c.minConfidence)
+		}
+		log.Printf("file %s attempt %d not accepted: %s", file.Name(), attempt, reason)
+		requestContent = append(requestContent, genai.Text(fmt.Sprintf(
+			"Your previous answer %s was not accepted: %s. Read the file again and answer with the JSON object only, quote the evidence exactly as it appears in the file.", answer, reason)))
+	}
+
+	if suggestion == nil {
+		suggestion = &Decision{}
+	}
+	suggestion.NeedsReview = true
+	err = c.review.Add(review.Item{
+		ID:         path,
+		Path:       path,
+		Text:       strings.Join(texts, "\n"),
+		Hash:       batch.ContentHash(fileContent),
+		Suggestion: suggestion.Category,
+		Confidence: suggestion.Confidence,
+		Evidence:   suggestion.Evidence,
+		Reason:     reason,
+		Labels:     c.categoryNames(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return suggestion, nil
+}
+
+// parseDecision validates the model answer against the schema: the category
+// must be one of the configured ones, the confidence within [0, 1] and the
+// evidence (when the file content is text) quoted from the file.
+func (c *Classifier) parseDecision(answer string, texts []string) (*Decision, error) {
+	var decision Decision
+	if err := json.Unmarshal([]byte(answer), &decision); err != nil {
+		return nil, fmt.Errorf("answer is not a valid JSON object: %v", err)
+	}
+	// the configured name is kept, custom categories need not be upper case
+	i := slices.IndexFunc(c.categories, func(category Category) bool {
+		return strings.EqualFold(category.Name, strings.TrimSpace(decision.Category))
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("unknown category %q", decision.Category)
+	}
+	decision.Category = c.categories[i].Name
+	if decision.Confidence < 0 || decision.Confidence > 1 {
+		return nil, fmt.Errorf("confidence %v out of range", decision.Confidence)
+	}
+	if strings.TrimSpace(decision.Evidence) == "" {
+		return nil, errors.New("evidence is empty")
+	}
+	if len(texts) > 0 && !containsQuote(texts, decision.Evidence) {
+		return nil, fmt.Errorf("evidence %q not found in the file", decision.Evidence)
+	}
+	return &decision, nil
+}
+
+func (c *Classifier) categoryNames() []string {
+	var names []string
+	for _, category := range c.categories {
+		names = append(names, category.Name)
+	}
+	return names
+}
+
+func (c *Classifier) responseSchema() *genai.Schema {
+	return &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"category":   {Type: genai.TypeString, Enum: c.categoryNames()},
+			"confidence": {Type: genai.TypeNumber, Description: "confidence between 0 and 1"},
+			"evidence":   {Type: genai.TypeString, Description: "fragment of the file quoted exactly, which justifies the category"},
+		},
+		Required: []string{"category", "confidence", "evidence"},
+	}
+}
+
+func (c *Classifier) preparePrompt() genai.Text {
+	prompt := "You are helpful assistant. Based on the provided instructions, classify the content of the send files (text, documents, images and audio recordings) into one of the following categories:"
+	for _, category := range c.categories {
+		prompt += fmt.Sprintf(" - \"%s\" if %s.", category.Name, category.Description)
+	}
+	return genai.Text(prompt + " Respond with JSON object {\"category\": \"<category>\", \"confidence\": <0-1>, \"evidence\": \"<exact quote from the file>\"}.")
+}
+
+func containsQuote(texts []string, quote string) bool {
+	normalizedQuote := strings.ToLower(strings.Join(strings.Fields(quote), " "))
+	for _, text := range texts {
+		if strings.Contains(strings.ToLower(strings.Join(strings.Fields(text), " ")), normalizedQuote) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,14 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"strings"
-	"time"
+	"os/signal"
+	"shared/batch"
+	"shared/ingest"
+	"shared/media"
+	"shared/review"
+	"shared/transcribe"
 
 	"github.com/google/generative-ai-go/genai"
 	"google.golang.org/api/option"
@@ -20,6 +25,8 @@ import (
 const modelType = "gemini-2.0-flash-exp"
 const rootDir = "../../pliki_z_fabryki"
 
+var registry = ingest.NewDefaultRegistry(media.GeminiLimits)
+
 type FinalAnswer struct {
 	Task   string         `json:"task"`
 	APIKey string         `json:"apikey"`
@@ -32,7 +39,19 @@ type Classification struct {
 }
 
 func main() {
-	ctx := context.Background()
+	workers := flag.Int("workers", 4, "number of files classified concurrently")
+	rpm := flag.Int("rpm", 10, "maximum number of Gemini requests per minute")
+	checkpointPath := flag.String("checkpoint", "checkpoint.jsonl", "file with already classified files, unchanged files are skipped on the next run")
+	rawMedia := flag.Bool("raw-media", false, "send audio and images to the classifier instead of their cached transcripts")
+	categoriesPath := flag.String("categories", "", "JSON file with the list of categories ({\"name\", \"description\"}), defaults to PEOPLE, HARDWARE and UNKNOWN")
+	minConfidence := flag.Float64("min-confidence", 0.7, "classifications below this confidence are re-asked and then sent to human review")
+	reviewDir := flag.String("review", "review", "directory with classifications waiting for human review and the reviewed decisions")
+	reviewAddr := flag.String("review-addr", "localhost:8080", "address of the review UI started when classifications wait for review, empty to skip the review")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	err := godotenv.Load("../../.env")
 	if err != nil {
 		log.Fatalf("could not load env variables %v", err)
@@ -47,55 +66,101 @@ func main() {
 
 	defer client.Close()
 
-	files, err := os.ReadDir(rootDir)
+	entries, err := os.ReadDir(rootDir)
 	if err != nil {
 		log.Fatal(err)
 	}
+	var files []os.DirEntry
+	for _, entry := range entries {
+		if !entry.IsDir() && !transcribe.IsArtifact(entry.Name()) {
+			files = append(files, entry)
+		}
+	}
 
-	people, hardware := categorizeFiles(files, ctx, client)
+	categories, err := loadCategories(*categoriesPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
-	log.Printf("people: %s", people)
-	log.Printf("hardware: %s", hardware)
-	sendResult(people, hardware)
-}
+	checkpoint, err := batch.OpenCheckpoint(*checkpointPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer checkpoint.Close()
 
-func categorizeFiles(files []os.DirEntry, ctx context.Context, client *genai.Client) ([]string, []string) {
-	var people []string
-	var hardware []string
-	for _, file := range files {
-		fileContent, err := os.ReadFile(fmt.Sprintf("%s/%s", rootDir, file.Name()))
-		if err != nil {
-			panic(err)
-		}
-		var requestContent []genai.Part
-
-		if strings.Contains(file.Name(), ".png") {
-			requestContent = append(requestContent, genai.ImageData("png", fileContent))
-		} else if strings.Contains(file.Name(), ".txt") {
-			requestContent = append(requestContent, genai.Text(file.Name()), genai.Text(fileContent))
-		} else if strings.Contains(file.Name(), ".mp3") {
-			requestContent = append(requestContent, genai.Text(file.Name()), genai.Blob{MIMEType: "audio/mp3", Data: fileContent})
-		} else {
-			log.Fatalf("error: unknown file type %s", file.Name())
-		}
+	reviewStore, err := review.Open(*reviewDir)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
-		requestContent = append(requestContent, preparePrompt())
-		category, err := callModel(requestContent, ctx, client)
-		if err != nil {
-			log.Fatalln(err)
+	limiter := batch.NewLimiter(map[string]int{"gemini": *rpm})
+	classifier := &Classifier{
+		client:        client,
+		limiter:       limiter,
+		checkpoint:    checkpoint,
+		categories:    categories,
+		minConfidence: *minConfidence,
+		review:        reviewStore,
+	}
+	if !*rawMedia {
+		classifier.preprocessor = newPreprocessor(client, limiter)
+	}
+
+	categorized := categorizeFiles(files, ctx, classifier, *workers)
+	abortIfInterrupted(ctx)
+	if len(reviewStore.Pending()) > 0 && *reviewAddr != "" {
+		reviewStore.Serve(*reviewAddr)
+		log.Printf("waiting for human review at http://%s", *reviewAddr)
+		if err := reviewStore.WaitUntilReviewed(ctx); err != nil {
+			log.Fatalf("review not finished: %v", err)
 		}
-		if strings.Contains(category, "PEOPLE") {
-			log.Printf("file %s classified to PEOPLE", file.Name())
-			people = append(people, file.Name())
-		} else if strings.Contains(category, "HARDWARE") {
-			log.Printf("file %s classified to HARDWARE", file.Name())
-			hardware = append(hardware, file.Name())
-		} else {
-			log.Printf("file %s not classified to any category", file.Name())
+		categorized = categorizeFiles(files, ctx, classifier, *workers)
+		abortIfInterrupted(ctx)
+	}
+
+	log.Printf("people: %s", categorized["PEOPLE"])
+	log.Printf("hardware: %s", categorized["HARDWARE"])
+	sendResult(categorized["PEOPLE"], categorized["HARDWARE"])
+}
+
+// abortIfInterrupted stops before an incomplete classification is sent, the
+// finished files are checkpointed and skipped on the next run.
+func abortIfInterrupted(ctx context.Context) {
+	if err := ctx.Err(); err != nil {
+		log.Fatalf("interrupted, the result is not sent: %v", err)
+	}
+}
+
+// categorizeFiles returns the file names grouped by category name. Files which
+// failed or wait for human review are not assigned to any category.
+func categorizeFiles(files []os.DirEntry, ctx context.Context, classifier *Classifier, workers int) map[string][]string {
+	results := batch.Run(ctx, files, workers, func(ctx context.Context, file os.DirEntry) (*Decision, error) {
+		return classifier.classify(ctx, file)
+	})
+
+	categorized := make(map[string][]string)
+	var failed []string
+	var pending []string
+	for i, result := range results {
+		name := files[i].Name()
+		switch {
+		case result.Err != nil:
+			log.Printf("error: file %s could not be classified: %v", name, result.Err)
+			failed = append(failed, name)
+		case result.Value.NeedsReview:
+			pending = append(pending, name)
+		default:
+			log.Printf("file %s classified to %s (%.2f): %q", name, result.Value.Category, result.Value.Confidence, result.Value.Evidence)
+			categorized[result.Value.Category] = append(categorized[result.Value.Category], name)
 		}
-		time.Sleep(10 * time.Second)
 	}
-	return people, hardware
+	if len(failed) > 0 {
+		log.Printf("warning: %d file(s) failed: %v", len(failed), failed)
+	}
+	if len(pending) > 0 {
+		log.Printf("warning: %d file(s) wait for human review: %v", len(pending), pending)
+	}
+	return categorized
 }
 
 func sendResult(people []string, hardware []string) {
@@ -133,21 +198,24 @@ func sendResult(people []string, hardware []string) {
 	log.Printf(string(bytesBody))
 }
 
-func callModel(requestContent []genai.Part, ctx context.Context, client *genai.Client) (string, error) {
+func callModel(requestContent []genai.Part, schema *genai.Schema, ctx context.Context, client *genai.Client) (string, error) {
 	model := client.GenerativeModel(modelType)
 
 	model.SetTemperature(0.5)
 	model.SetTopK(40)
 	model.SetTopP(0.95)
 	model.SetMaxOutputTokens(8192)
+	if schema != nil {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = schema
+	}
 
 	session := model.StartChat()
 	session.History = []*genai.Content{}
 
 	resp, err := session.SendMessage(ctx, requestContent...)
 	if err != nil {
-		log.Fatalf("Error sending message: %v", err)
-		return "", err
+		return "", fmt.Errorf("error sending message: %v", err)
 	}
 
 	for _, part := range resp.Candidates[0].Content.Parts {
@@ -156,11 +224,3 @@ func callModel(requestContent []genai.Part, ctx context.Context, client *genai.C
 	}
 	return "", nil
 }
-
-func preparePrompt() genai.Text {
-	return "You are helpful assistant. Based on the provided instructions, classify the content of the send files (.mp3, .png and .txt) into one of the following categories:" +
-		" - \"PEOPLE\" if the note contains information about captured people or traced of their presence." +
-		" - \"HARDWARE\" if the note contains information only about the repaired hardware faults, software issues should not be included to this category." +
-		" - \"UNKNOWN\" if the file can not be assigned to PEOPLE or HARDWARE category." +
-		"Your response should contains only category."
-}
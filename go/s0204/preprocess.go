@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"github.com/google/generative-ai-go/genai"
+	"shared/batch"
+	"shared/media"
+	"shared/transcribe"
+)
+
+func newPreprocessor(client *genai.Client, limiter *batch.Limiter) *transcribe.Preprocessor {
+	return transcribe.NewPreprocessorFromEnv(media.GeminiLimits, limiter, func(ctx context.Context, img *media.Image) (string, error) {
+		return callModel([]genai.Part{genai.ImageData(media.Format(img.MIME), img.Data), prepareOCRPrompt()}, nil, ctx, client)
+	})
+}
+
+func prepareOCRPrompt() genai.Text {
+	return "Przepisz dokładnie cały tekst widoczny na obrazie, zachowując oryginalny język i podział na linie. " +
+		"Nie dodawaj komentarzy ani opisu obrazu. Jeżeli na obrazie nie ma tekstu, zwróć pustą odpowiedź."
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/generative-ai-go/genai"
+	"log"
+	"shared/batch"
+	"shared/polish"
+	"shared/retrieval"
+	"slices"
+	"time"
+)
+
+type Question struct {
+	ID   string
+	Text string
+}
+
+// Answerer answers a single question from the retrieved chunks. Questions are
+// answered concurrently, so every model call waits for the shared limiter.
+type Answerer struct {
+	client   *genai.Client
+	limiter  *batch.Limiter
+	searcher *retrieval.HybridSearcher
+	topK     int
+	rawMedia bool
+	retries  int
+}
+
+// answer retries failed calls and invalid answers up to retries times, with
+// a growing pause between the attempts.
+func (a *Answerer) answer(ctx context.Context, question Question) (*AnswerWithSources, error) {
+	var lastErr error
+	for attempt := 1; attempt <= a.retries; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(attempt-1) * 5 * time.Second):
+			}
+		}
+		entry, err := a.try(ctx, question)
+		if err == nil {
+			return entry, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+		log.Printf("question %s attempt %d failed: %v", question.ID, attempt, err)
+	}
+	return nil, fmt.Errorf("no answer after %d attempts: %v", a.retries, lastErr)
+}
+
+func (a *Answerer) try(ctx context.Context, question Question) (*AnswerWithSources, error) {
+	log.Printf("calling for answer on question %s", question.Text)
+	hits, err := a.searcher.Search(ctx, question.Text, a.topK, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	promptMessages := []genai.Part{systemPrompt()}
+	promptMessages = slices.Concat(promptMessages, prepareChunks(hits, a.rawMedia))
+	message := genai.Text(fmt.Sprintf("Pytanie: %s", question.Text))
+	if err := a.limiter.Wait(ctx, "gemini"); err != nil {
+		return nil, err
+	}
+	resp, err := callModel(append(promptMessages, citationsPrompt(), message), answerSchema(), ctx, a.client)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := parseAnswer(question.ID, question.Text, resp, hits)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Answer == "" {
+		return nil, errors.New("the answer is empty")
+	}
+	log.Printf("answer on question %s: %s %v", question.ID, entry.Answer, entry.Citations)
+	if !entry.Consistent {
+		log.Printf("warning: answer on question %s is not consistent with its evidence: %v", question.ID, entry.Issues)
+	}
+	return entry, nil
+}
+
+// newSearcher searches the chunks by keywords, by meaning or both, the
+// reranker shares the limiter with the answers.
+func newSearcher(client *genai.Client, limiter *batch.Limiter, index *retrieval.VectorIndex, chunks []retrieval.Document, mode string, rerank bool) (*retrieval.HybridSearcher, error) {
+	searcher := &retrieval.HybridSearcher{Embedder: &geminiEmbedder{client: client, taskType: genai.TaskTypeRetrievalQuery}}
+	keywords := retrieval.NewBM25Index(chunks, retrieval.PolishAnalyzer(polish.NewLemmatizer()))
+	switch mode {
+	case "hybrid":
+		searcher.Vector, searcher.Keywords = index, keywords
+	case "vector":
+		searcher.Vector = index
+	case "keyword":
+		searcher.Keywords = keywords
+	default:
+		return nil, fmt.Errorf("unknown search %q, use hybrid, vector or keyword", mode)
+	}
+	if rerank {
+		searcher.Reranker = &retrieval.LLMReranker{Complete: func(ctx context.Context, prompt string) (string, error) {
+			if err := limiter.Wait(ctx, "gemini"); err != nil {
+				return "", err
+			}
+			return callModel([]genai.Part{genai.Text(prompt)}, rerankSchema(), ctx, client)
+		}}
+	}
+	return searcher, nil
+}
+
+func rerankSchema() *genai.Schema {
+	return &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"scores": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"document": {Type: genai.TypeInteger},
+						"score":    {Type: genai.TypeNumber},
+					},
+					Required: []string{"document", "score"},
+				},
+			},
+		},
+		Required: []string{"scores"},
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var assetDirs = map[string]string{
+	"image": "images",
+	"audio": "audio",
+	"video": "video",
+}
+
+var unsafeNameRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Asset is an entry of the snapshot manifest which maps the original URL to
+// the file, Path is relative to the snapshot directory.
+type Asset struct {
+	URL  string `json:"url"`
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+}
+
+// assetRef is a media element found in the article. refs are the raw
+// attribute values (src, srcset candidates) which point to the same asset.
+type assetRef struct {
+	kind string
+	url  string
+	refs []string
+}
+
+// discoverAssets finds images (img, picture, srcset, video posters), audio and
+// video in the article and resolves their URLs against the page base.
+func discoverAssets(doc *goquery.Document, pageURL string) ([]assetRef, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("error: invalid page url %s: %v", pageURL, err)
+	}
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if baseHref, err := base.Parse(href); err == nil {
+			base = baseHref
+		}
+	}
+
+	var found []assetRef
+	add := func(kind string, candidates []string) {
+		var ref assetRef
+		for _, candidate := range candidates {
+			if candidate == "" {
+				continue
+			}
+			resolved, err := base.Parse(candidate)
+			if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+				continue
+			}
+			if ref.url == "" {
+				ref.url = resolved.String()
+			}
+			ref.refs = append(ref.refs, candidate)
+		}
+		if ref.url != "" {
+			ref.kind = kind
+			found = append(found, ref)
+		}
+	}
+
+	doc.Find("img").Each(func(i int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		srcset, _ := s.Attr("srcset")
+		candidates := append(parseSrcset(srcset), src)
+		if s.Parent().Is("picture") {
+			s.Parent().Find("source").Each(func(j int, source *goquery.Selection) {
+				sourceSrcset, _ := source.Attr("srcset")
+				candidates = append(candidates, parseSrcset(sourceSrcset)...)
+			})
+		}
+		add("image", candidates)
+	})
+	doc.Find("audio, video").Each(func(i int, s *goquery.Selection) {
+		kind := goquery.NodeName(s)
+		src, _ := s.Attr("src")
+		candidates := []string{src}
+		s.Find("source").Each(func(j int, source *goquery.Selection) {
+			sourceSrc, _ := source.Attr("src")
+			candidates = append(candidates, sourceSrc)
+		})
+		add(kind, candidates)
+		if poster, ok := s.Attr("poster"); ok {
+			add("image", []string{poster})
+		}
+	})
+	return found, nil
+}
+
+// parseSrcset returns the srcset candidates ordered from the largest one.
+func parseSrcset(srcset string) []string {
+	type candidate struct {
+		url  string
+		size float64
+	}
+	var candidates []candidate
+	for _, entry := range strings.Split(srcset, ",") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		size := 1.0
+		if len(fields) > 1 {
+			descriptor := fields[1]
+			if value, err := strconv.ParseFloat(descriptor[:len(descriptor)-1], 64); err == nil {
+				size = value
+			}
+		}
+		candidates = append(candidates, candidate{url: fields[0], size: size})
+	}
+
+	var urls []string
+	for len(candidates) > 0 {
+		best := 0
+		for i, c := range candidates {
+			if c.size > candidates[best].size {
+				best = i
+			}
+		}
+		urls = append(urls, candidates[best].url)
+		candidates = append(candidates[:best], candidates[best+1:]...)
+	}
+	return urls
+}
+
+// assetName derives a file name from the URL path which is safe to use on disk.
+// Different URLs with the same name get a short hash of the URL appended.
+func assetName(rawURL string, kind string, used map[string]string) string {
+	parsed, _ := url.Parse(rawURL)
+	name := unsafeNameRegexp.ReplaceAllString(path.Base(parsed.Path), "_")
+	name = strings.Trim(name, "._")
+	if name == "" {
+		name = kind
+	}
+
+	if owner, ok := used[name]; ok && owner != rawURL {
+		sum := sha256.Sum256([]byte(rawURL))
+		ext := path.Ext(name)
+		name = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(name, ext), hex.EncodeToString(sum[:4]), ext)
+	}
+	used[name] = rawURL
+	return name
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/generative-ai-go/genai"
+	"regexp"
+	"shared/retrieval"
+	"strings"
+)
+
+const embeddingModel = "text-embedding-004"
+
+var mediaRefRegexp = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)\)|\[(?:Dźwięk|Wideo): ([^\]\s]+)\]`)
+
+// chunkMarkdown splits the indexed article into chunks of about maxChars.
+// Every chunk starts with the path of the headings it belongs to, media are
+// kept together with the paragraphs around them and with their captions.
+func chunkMarkdown(markdown string, maxChars int) []retrieval.Document {
+	var chunks []retrieval.Document
+	var headings []string
+	var paragraphs []string
+	size := 0
+
+	flush := func() {
+		if len(paragraphs) == 0 {
+			return
+		}
+		text := strings.Join(paragraphs, "\n\n")
+		if len(headings) > 0 {
+			text = fmt.Sprintf("Sekcja: %s\n\n%s", strings.Join(headings, " > "), text)
+		}
+		var media []string
+		for _, match := range mediaRefRegexp.FindAllStringSubmatch(text, -1) {
+			media = append(media, match[1]+match[2])
+		}
+		chunks = append(chunks, retrieval.Document{
+			ID:       fmt.Sprintf("chunk-%03d", len(chunks)+1),
+			Text:     text,
+			Metadata: map[string]string{"section": strings.Join(headings, " > "), "media": strings.Join(media, ",")},
+		})
+		paragraphs = nil
+		size = 0
+	}
+
+	for _, paragraph := range strings.Split(markdown, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if level := headingLevel(paragraph); level > 0 {
+			flush()
+			if level > len(headings) {
+				level = len(headings) + 1
+			}
+			headings = append(headings[:level-1], strings.TrimSpace(paragraph[level:]))
+			continue
+		}
+		attached := len(paragraphs) > 0 && (isCaption(paragraph) || isMediaOnly(paragraph) || isMediaOnly(paragraphs[len(paragraphs)-1]))
+		if size+len(paragraph) > maxChars && !attached {
+			flush()
+		}
+		paragraphs = append(paragraphs, paragraph)
+		size += len(paragraph)
+	}
+	flush()
+	return chunks
+}
+
+func headingLevel(paragraph string) int {
+	level := 0
+	for level < len(paragraph) && paragraph[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || level == len(paragraph) || paragraph[level] != ' ' || strings.Contains(paragraph, "\n") {
+		return 0
+	}
+	return level
+}
+
+func isCaption(paragraph string) bool {
+	return strings.HasPrefix(paragraph, "_") && strings.HasSuffix(paragraph, "_")
+}
+
+func isMediaOnly(paragraph string) bool {
+	return strings.TrimSpace(mediaRefRegexp.ReplaceAllString(paragraph, "")) == ""
+}
+
+func chunkMedia(doc retrieval.Document) []string {
+	if doc.Metadata["media"] == "" {
+		return nil
+	}
+	return strings.Split(doc.Metadata["media"], ",")
+}
+
+// geminiEmbedder embeds texts with the Gemini embedding model, taskType tells
+// whether the texts are indexed documents or questions.
+type geminiEmbedder struct {
+	client   *genai.Client
+	taskType genai.TaskType
+}
+
+func (e *geminiEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	model := e.client.EmbeddingModel(embeddingModel)
+	model.TaskType = e.taskType
+	batch := model.NewBatch()
+	for _, text := range texts {
+		batch.AddContent(genai.Text(text))
+	}
+	resp, err := model.BatchEmbedContents(ctx, batch)
+	if err != nil {
+		return nil, fmt.Errorf("error: embedding failed: %v", err)
+	}
+	var vectors [][]float32
+	for _, embedding := range resp.Embeddings {
+		vectors = append(vectors, embedding.Values)
+	}
+	return vectors, nil
+}
+
+// loadIndex reuses the persisted index when it was built from the same chunks,
+// otherwise the chunks are embedded again.
+func loadIndex(ctx context.Context, client *genai.Client, path string, chunks []retrieval.Document) (*retrieval.VectorIndex, error) {
+	if index, err := retrieval.LoadVectorIndex(path); err == nil && index.Matches(embeddingModel, chunks) {
+		return index, nil
+	}
+	index, err := retrieval.BuildVectorIndex(ctx, &geminiEmbedder{client: client, taskType: genai.TaskTypeRetrievalDocument}, embeddingModel, chunks, 100)
+	if err != nil {
+		return nil, err
+	}
+	return index, index.Save(path)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"github.com/google/generative-ai-go/genai"
+	"log"
+	"os"
+	"shared/batch"
+	"shared/media"
+	"shared/transcribe"
+)
+
+// newDescriber captions images with Gemini and transcribes audio with an
+// OpenAI compatible speech-to-text endpoint. STT_BASE_URL may point to a local
+// server or a mock. Results are cached next to the snapshot files.
+func newDescriber(client *genai.Client, limiter *batch.Limiter) *transcribe.Preprocessor {
+	return transcribe.NewPreprocessorFromEnv(media.GeminiLimits, limiter, func(ctx context.Context, img *media.Image) (string, error) {
+		return callModel([]genai.Part{genai.ImageData(media.Format(img.MIME), img.Data), prepareCaptionPrompt()}, nil, ctx, client)
+	})
+}
+
+// describeAssets returns the caption or transcript of every asset file, the
+// files which could not be described are left out.
+func describeAssets(ctx context.Context, describer *transcribe.Preprocessor, assets map[string]string) map[string]string {
+	descriptions := make(map[string]string)
+	for _, file := range assets {
+		if _, ok := descriptions[file]; ok {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Printf("warning: could not read %s: %v", file, err)
+			continue
+		}
+		text, ok, err := describer.Text(ctx, file, data)
+		if err != nil {
+			log.Printf("warning: could not describe %s: %v", file, err)
+			continue
+		}
+		if ok {
+			descriptions[file] = text
+		}
+	}
+	return descriptions
+}
+
+func prepareCaptionPrompt() genai.Text {
+	return "Opisz dokładnie po polsku co przedstawia obraz: obiekty, miejsca, osoby, kolory i czynności. " +
+		"Jeżeli na obrazie jest tekst, przepisz go dosłownie. Odpowiedz samym opisem, bez wstępu."
+}
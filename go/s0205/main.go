@@ -4,24 +4,32 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/google/generative-ai-go/genai"
 	"github.com/joho/godotenv"
-	"golang.org/x/net/html"
 	"google.golang.org/api/option"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"shared/batch"
+	"shared/gemini"
+	"shared/ingest"
+	"shared/media"
+	"shared/retrieval"
 	"slices"
 	"strings"
-	"time"
 )
 
 const modelType = "gemini-2.0-flash-exp"
 
+var registry = ingest.NewDefaultRegistry(media.GeminiLimits)
+
 type FinalAnswer struct {
 	Task   string            `json:"task"`
 	APIKey string            `json:"apikey"`
@@ -29,7 +37,21 @@ type FinalAnswer struct {
 }
 
 func main() {
-	ctx := context.Background()
+	topK := flag.Int("top-k", 4, "number of article chunks sent to the model with each question")
+	chunkSize := flag.Int("chunk-size", 1500, "approximate size of an article chunk in characters")
+	snapshotDir := flag.String("snapshot", "snapshot", "directory with the captured article and its media, the article is indexed from it")
+	refresh := flag.Bool("refresh", false, "capture the article again even if the snapshot exists")
+	workers := flag.Int("workers", 3, "number of questions answered concurrently")
+	rpm := flag.Int("rpm", 10, "maximum number of Gemini requests per minute")
+	retries := flag.Int("retries", 3, "number of attempts per question")
+	mode := flag.String("search", "hybrid", "how the chunks are searched: hybrid (keywords and vectors fused), vector or keyword")
+	rerank := flag.Bool("rerank", false, "let Gemini reorder the found chunks by their relevance to the question")
+	rawMedia := flag.Bool("raw-media", false, "send the images and audio of the retrieved chunks to the model besides their captions and transcripts")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	err := godotenv.Load("../../.env")
 
 	if err != nil {
@@ -40,50 +62,82 @@ func main() {
 	aiDevsApiKey := os.Getenv("AI_DEVS_API_KEY")
 	geminiApiKey := os.Getenv("GEMINI_API_KEY")
 
-	doIndexing(host, "dane/arxiv-draft.html")
+	client, err := genai.NewClient(ctx, option.WithAPIKey(geminiApiKey))
+	if err != nil {
+		log.Fatalf("Error creating client: %v", err)
+	}
+
+	limiter := batch.NewLimiter(map[string]int{"gemini": *rpm})
+	doIndexing(ctx, client, limiter, fmt.Sprintf("%s/dane/arxiv-draft.html", host), *snapshotDir, *refresh)
 
 	questions := fetchQuestions(host, aiDevsApiKey)
 
-	promptMessages := []genai.Part{}
-	promptMessages = append(promptMessages, systemPrompt())
-	promptMessages = slices.Concat(promptMessages, prepareIndexedContent("indexed.md"))
-	promptMessages = slices.Concat(promptMessages, prepareMessages("downloaded_images"))
-	promptMessages = slices.Concat(promptMessages, prepareMessages("downloaded_audio"))
+	indexed, err := os.ReadFile("indexed.md")
+	if err != nil {
+		log.Fatalln("error: could not read indexed.md", err)
+	}
+	chunks := chunkMarkdown(string(indexed), *chunkSize)
+	index, err := loadIndex(ctx, client, "index.json", chunks)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("article indexed in %d chunks", len(chunks))
+
+	items := make([]Question, 0, len(questions))
+	for id, question := range questions {
+		items = append(items, Question{ID: id, Text: question})
+	}
+	slices.SortFunc(items, func(a, b Question) int { return strings.Compare(a.ID, b.ID) })
 
-	client, err := genai.NewClient(ctx, option.WithAPIKey(geminiApiKey))
+	searcher, err := newSearcher(client, limiter, index, chunks, *mode, *rerank)
 	if err != nil {
-		log.Fatalf("Error creating client: %v", err)
+		log.Fatalln(err)
 	}
+	answerer := &Answerer{client: client, limiter: limiter, searcher: searcher, topK: *topK, rawMedia: *rawMedia, retries: *retries}
+	results := batch.Run(ctx, items, *workers, answerer.answer)
 
 	answers := make(map[string]string)
-	for id, question := range questions {
-		log.Printf("calling for answer on question %s", question)
-		message := genai.Text(fmt.Sprintf("Pytanie: %s", question))
-		resp, err := callModel(append(promptMessages, message), ctx, client)
-		if err != nil {
-			log.Fatalln("error: something went wrong while calling response", err)
+	var report []*AnswerWithSources
+	var missing []string
+	for i, result := range results {
+		entry := result.Value
+		if result.Err != nil {
+			log.Printf("error: question %s not answered: %v", items[i].ID, result.Err)
+			entry = &AnswerWithSources{ID: items[i].ID, Question: items[i].Text, Error: result.Err.Error()}
+			missing = append(missing, items[i].ID)
+		} else {
+			answers[entry.ID] = entry.Answer
 		}
-		log.Printf("answer: %s", resp)
-		answers[id] = resp
-		time.Sleep(5 * time.Second)
+		report = append(report, entry)
+	}
+	if err := saveReport(report); err != nil {
+		log.Printf("warning: %v", err)
+	}
+	if err := ctx.Err(); err != nil {
+		log.Fatalf("interrupted, the report is saved but the answers are not sent: %v", err)
+	}
+	if len(answers) == 0 {
+		log.Fatalln("error: no question was answered")
+	}
+	if len(missing) > 0 {
+		log.Printf("warning: sending %d of %d answers, missing: %v", len(answers), len(items), missing)
 	}
 	sendResult(host, aiDevsApiKey, answers)
 }
 
-func doIndexing(host string, path string) {
-	resp, err := http.Get(fmt.Sprintf("%s/%s", host, path))
-	if err != nil {
-		log.Fatalf("error: getting article failed: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		log.Fatalf("error: status %d %s", resp.StatusCode, resp.Status)
+// doIndexing captures the article once and builds indexed.md from the
+// snapshot, so re-indexing does not touch the network.
+func doIndexing(ctx context.Context, client *genai.Client, limiter *batch.Limiter, pageURL string, snapshotDir string, refresh bool) {
+	if _, err := os.Stat(filepath.Join(snapshotDir, snapshotManifest)); refresh || err != nil {
+		log.Printf("capturing %s to %s", pageURL, snapshotDir)
+		if err := captureSnapshot(pageURL, snapshotDir); err != nil {
+			log.Fatalln(err)
+		}
 	}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	doc, assets, err := openSnapshot(snapshotDir)
 	if err != nil {
-		log.Fatalf("error: html parsing failed: %v", err)
+		log.Fatalf("error: could not open snapshot %s: %v", snapshotDir, err)
 	}
 
 	outFile, err := os.Create("indexed.md")
@@ -92,67 +146,17 @@ func doIndexing(host string, path string) {
 	}
 	defer outFile.Close()
 
-	fmt.Fprintln(outFile, "# Indeksowany artykuł profesora Maja\n")
-
-	doTextIndexing(outFile, doc)
-	doImagesIndexing(host, outFile, doc)
-	doAudioIndexing(host, outFile, doc, err)
+	descriptions := describeAssets(ctx, newDescriber(client, limiter), assets)
+	doTextIndexing(outFile, doc, assets, descriptions)
 	fmt.Println("indexed.md file creation finished")
 }
 
-func doAudioIndexing(host string, outFile *os.File, doc *goquery.Document, err error) {
-	fmt.Fprintln(outFile, "\n## Dźwięki\n")
-	doc.Find("audio").Each(func(i int, s *goquery.Selection) {
-		src, exists := s.Attr("src")
-		if !exists || src == "" {
-			s.Find("source").Each(func(j int, source *goquery.Selection) {
-				if val, ok := source.Attr("src"); ok && src == "" {
-					src = val
-				}
-			})
-		}
-		name := src[2:]
-		src = fmt.Sprintf("%s/dane/%s", host, src)
-		context := getParentContext(s)
-		err = downloadFile(src, "downloaded_audio", name)
-		if err != nil {
-			log.Printf("error: could not fetch audio file %s: %v", src, err)
-		} else {
-			log.Printf("file saved: %s", filepath.Join("downloaded_audio", name))
-		}
-
-		fmt.Fprintf(outFile, "- Dźwięk %d: src='%s', name='%s' Kontekst: %s\n", i+1, src, name, context)
-	})
-}
-
-func doImagesIndexing(host string, outFile *os.File, doc *goquery.Document) {
-	fmt.Fprintln(outFile, "\n## Obrazy\n")
-	doc.Find("img").Each(func(i int, s *goquery.Selection) {
-		src, _ := s.Attr("src")
-		alt, _ := s.Attr("alt")
-		name := src[2:]
-		src = fmt.Sprintf("%s/dane/%s", host, src)
-		context := getParentContext(s)
-
-		err := downloadFile(src, "downloaded_images", name)
-		if err != nil {
-			log.Printf("error: could not fetch image %s: %v", src, err)
-		} else {
-			log.Printf("file saved %s", filepath.Join("downloaded_images", name))
-		}
-
-		fmt.Fprintf(outFile, "- Obraz %d: src='%s', alt='%s', name='%s' Kontekst: %s\n", i+1, src, alt, name, context)
-	})
-}
-
-func doTextIndexing(outFile *os.File, doc *goquery.Document) {
-	fmt.Fprintln(outFile, "## Treść tekstowa\n")
-	doc.Find("p").Each(func(i int, s *goquery.Selection) {
-		text := s.Text()
-		if text != "" {
-			fmt.Fprintf(outFile, "- %s\n", text)
-		}
-	})
+// doTextIndexing writes the article as Markdown, images and audio are placed
+// where they appear in the article, point to the downloaded files and carry
+// their captions and transcripts.
+func doTextIndexing(outFile *os.File, doc *goquery.Document, assets map[string]string, descriptions map[string]string) {
+	fmt.Fprint(outFile, "# Indeksowany artykuł profesora Maja\n\n")
+	fmt.Fprint(outFile, htmlToMarkdown(doc, assets, descriptions))
 }
 
 func downloadFile(fileURL, destDir, fileName string) error {
@@ -186,25 +190,6 @@ func downloadFile(fileURL, destDir, fileName string) error {
 	return nil
 }
 
-func getParentContext(s *goquery.Selection) string {
-	parent := s.Parent()
-	if parent.Length() == 0 {
-		return "Brak elementu nadrzędnego"
-	}
-
-	tagName := "unknown"
-	if len(parent.Nodes) > 0 && parent.Nodes[0].Type == html.ElementNode {
-		tagName = parent.Nodes[0].Data
-	}
-
-	contextText := strings.TrimSpace(parent.Text())
-	if len(contextText) > 100 {
-		contextText = contextText[:100] + "..."
-	}
-
-	return fmt.Sprintf("<%s> - \"%s\"", tagName, contextText)
-}
-
 func sendResult(host string, apikey string, answers map[string]string) {
 	client := http.Client{}
 
@@ -272,53 +257,59 @@ func fetchQuestions(host string, apikey string) map[string]string {
 	return questions
 }
 
-func prepareIndexedContent(file string) []genai.Part {
-	fileContent, err := os.ReadFile(file)
-	if err != nil {
-		log.Fatalln(fmt.Sprintf("error: could not read file %s", file), err)
-	}
-	return []genai.Part{genai.Text("This is indexed content."), genai.Text(fileContent)}
-}
-
-func prepareMessages(dir string) []genai.Part {
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		log.Fatal(err)
-	}
-
+// prepareChunks sends the retrieved chunks, with rawMedia followed by the
+// images and audio they refer to.
+func prepareChunks(hits []retrieval.Hit, rawMedia bool) []genai.Part {
 	var requestContent []genai.Part
+	var files []string
+	for _, hit := range hits {
+		log.Printf("chunk %s (%.3f) %s", hit.ID, hit.Score, hit.Metadata["section"])
+		requestContent = append(requestContent, genai.Text(fmt.Sprintf("Fragment %s:\n%s", hit.ID, hit.Text)))
+		for _, file := range chunkMedia(hit.Document) {
+			if rawMedia && !slices.Contains(files, file) {
+				files = append(files, file)
+			}
+		}
+	}
 
 	for _, file := range files {
-		fileContent, err := os.ReadFile(fmt.Sprintf("%s/%s", dir, file.Name()))
+		fileContent, err := os.ReadFile(file)
 		if err != nil {
-			log.Fatalln("error: could not read file ", err)
+			log.Printf("warning: could not read file %s: %v", file, err)
+			continue
 		}
-		if strings.Contains(file.Name(), ".png") {
-			requestContent = append(requestContent, genai.Text(file.Name()), genai.ImageData("png", fileContent))
-		} else if strings.Contains(file.Name(), ".mp3") {
-			requestContent = append(requestContent, genai.Text(file.Name()), genai.Blob{MIMEType: "audio/mp3", Data: fileContent})
-		} else {
-			log.Printf("warning: unknown file type %s", file.Name())
+		parts, err := registry.Parts(file, fileContent)
+		if err != nil {
+			log.Printf("warning: %v", err)
+			continue
 		}
+		requestContent = append(requestContent, genai.Text(file))
+		requestContent = append(requestContent, gemini.Parts(file, parts)...)
 	}
 	return requestContent
 }
 
-func callModel(requestContent []genai.Part, ctx context.Context, client *genai.Client) (string, error) {
+func callModel(requestContent []genai.Part, schema *genai.Schema, ctx context.Context, client *genai.Client) (string, error) {
 	model := client.GenerativeModel(modelType)
 
 	model.SetTemperature(0.5)
 	model.SetTopK(40)
 	model.SetTopP(0.95)
 	model.SetMaxOutputTokens(8192)
+	if schema != nil {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = schema
+	}
 
 	session := model.StartChat()
 	session.History = []*genai.Content{}
 
 	resp, err := session.SendMessage(ctx, requestContent...)
 	if err != nil {
-		log.Fatalf("Error sending message: %v", err)
-		return "", err
+		return "", fmt.Errorf("error sending message: %v", err)
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return "", errors.New("error: model returned no candidates")
 	}
 
 	for _, part := range resp.Candidates[0].Content.Parts {
@@ -330,9 +321,9 @@ func callModel(requestContent []genai.Part, ctx context.Context, client *genai.C
 
 func systemPrompt() genai.Text {
 	return "Jesteś pomocnym asystentem. Otrzymasz rożny kontent pochodzący z zaindeksowaniej strony HTML. " +
-		"Kontent zawiera zaindeksowaną strone HTML (plik indexed.md) a także obrazy (pliki .png) oraz ścieżki audito (pliki .mp3). " +
-		"Plik indexed.md zawiera przechwycone materiały które muszą Ci posłużyć do odpowiedzenia na pytania które otrzymasz. " +
-		"W celu udzielenie odpowiedzi na pytania, musisz wziąć pod uwagę plik indexed.md a także pliki .png oraz .mp3." +
+		"Kontent zawiera fragmenty zaindeksowanej strony HTML najbardziej związane z pytaniem. Obrazy i nagrania audio są w fragmentach opisane ([Opis obrazu: ...]) i przepisane ([Transkrypcja: ...]), mogą być też dołączone jako pliki .png oraz .mp3. " +
+		"Fragmenty zawierają przechwycone materiały które muszą Ci posłużyć do odpowiedzenia na pytania które otrzymasz. " +
+		"W celu udzielenie odpowiedzi na pytania, musisz wziąć pod uwagę treść fragmentów, opisy obrazów i transkrypcje nagrań." +
 		"Odpowiedź na pytanie powinna być krótka i zwięzła, bez dodatkowych znaków. Jeżeli jest to możliwe to odpowiedź powinna być w formie jednego wyrazu." +
 		"Dodatkowe informacje które powinieneś uwzględnić to to że Rynek to nie miasto. A w pytanie o Owoc musisz podać nazwę owocu. W przypadku nazw własnych podaj nazwy w oryginalnym języku."
 }
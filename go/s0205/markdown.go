@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+// markdownConverter walks the article DOM and writes Markdown in the document
+// order. assets maps the src of images and audio to the downloaded local files,
+// descriptions maps these files to their captions and transcripts.
+type markdownConverter struct {
+	assets       map[string]string
+	descriptions map[string]string
+	b            strings.Builder
+}
+
+var spacesRegexp = regexp.MustCompile(`\s+`)
+
+var skippedTags = map[string]bool{"head": true, "script": true, "style": true, "noscript": true, "template": true, "nav": true}
+
+var blockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "body": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"figcaption": true, "figure": true, "footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "header": true, "hr": true, "html": true, "li": true, "main": true, "ol": true, "p": true, "pre": true,
+	"section": true, "table": true, "ul": true, "video": true, "audio": true,
+}
+
+func htmlToMarkdown(doc *goquery.Document, assets map[string]string, descriptions map[string]string) string {
+	c := &markdownConverter{assets: assets, descriptions: descriptions}
+	for _, node := range doc.Selection.Nodes {
+		c.blocks(node)
+	}
+	return strings.TrimSpace(c.b.String()) + "\n"
+}
+
+// blocks writes the children of n, consecutive inline children are joined to
+// a single paragraph.
+func (c *markdownConverter) blocks(n *html.Node) {
+	var inline strings.Builder
+	flush := func() {
+		c.paragraph(collapseSpaces(inline.String()))
+		inline.Reset()
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && skippedTags[child.Data] {
+			continue
+		}
+		if child.Type == html.ElementNode && blockTags[child.Data] {
+			flush()
+			c.block(child)
+			continue
+		}
+		inline.WriteString(c.inline(child))
+	}
+	flush()
+}
+
+func (c *markdownConverter) block(n *html.Node) {
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(n.Data[1] - '0')
+		c.paragraph(strings.Repeat("#", level) + " " + c.inlineText(n))
+	case "p", "dt", "dd":
+		c.blocks(n)
+	case "ul", "ol":
+		c.list(n, 0)
+		c.b.WriteString("\n")
+	case "table":
+		c.table(n)
+	case "pre":
+		c.paragraph("```\n" + strings.Trim(textContent(n), "\n") + "\n```")
+	case "blockquote":
+		quote := markdownConverter{assets: c.assets, descriptions: c.descriptions}
+		quote.blocks(n)
+		lines := strings.Split(strings.TrimSpace(quote.b.String()), "\n")
+		c.paragraph("> " + strings.Join(lines, "\n> "))
+	case "figcaption":
+		if caption := c.inlineText(n); caption != "" {
+			c.paragraph("_" + caption + "_")
+		}
+	case "hr":
+		c.paragraph("---")
+	case "audio", "video":
+		c.paragraph(c.media(n))
+	default:
+		c.blocks(n)
+	}
+}
+
+func (c *markdownConverter) paragraph(text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	c.b.WriteString(text)
+	c.b.WriteString("\n\n")
+}
+
+func (c *markdownConverter) list(n *html.Node, depth int) {
+	number := 1
+	for item := n.FirstChild; item != nil; item = item.NextSibling {
+		if item.Type != html.ElementNode || item.Data != "li" {
+			continue
+		}
+		marker := "-"
+		if n.Data == "ol" {
+			marker = fmt.Sprintf("%d.", number)
+			number++
+		}
+		var text strings.Builder
+		var nested []*html.Node
+		for child := item.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == html.ElementNode && (child.Data == "ul" || child.Data == "ol") {
+				nested = append(nested, child)
+				continue
+			}
+			text.WriteString(c.inline(child))
+		}
+		fmt.Fprintf(&c.b, "%s%s %s\n", strings.Repeat("  ", depth), marker, collapseSpaces(text.String()))
+		for _, list := range nested {
+			c.list(list, depth+1)
+		}
+	}
+}
+
+func (c *markdownConverter) table(n *html.Node) {
+	var rows [][]string
+	var caption string
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			switch child.Data {
+			case "caption":
+				caption = c.inlineText(child)
+			case "tr":
+				var row []string
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+						row = append(row, strings.ReplaceAll(c.inlineText(cell), "|", "\\|"))
+					}
+				}
+				rows = append(rows, row)
+			case "thead", "tbody", "tfoot":
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return
+	}
+
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	var b strings.Builder
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		}
+	}
+	c.paragraph(b.String())
+	if caption != "" {
+		c.paragraph("_" + caption + "_")
+	}
+}
+
+func (c *markdownConverter) inlineText(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(c.inline(child))
+	}
+	return collapseSpaces(b.String())
+}
+
+func (c *markdownConverter) inline(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return spacesRegexp.ReplaceAllString(n.Data, " ")
+	}
+	if n.Type != html.ElementNode || skippedTags[n.Data] {
+		return ""
+	}
+	switch n.Data {
+	case "br":
+		return "\n"
+	case "img":
+		return c.image(n)
+	case "audio", "video":
+		return " " + c.media(n) + " "
+	case "strong", "b":
+		return wrap("**", c.inlineText(n))
+	case "em", "i":
+		return wrap("*", c.inlineText(n))
+	case "code":
+		return wrap("`", textContent(n))
+	case "a":
+		text := c.inlineText(n)
+		if href := attr(n, "href"); href != "" && text != "" && !strings.HasPrefix(href, "#") {
+			return fmt.Sprintf("[%s](%s)", text, href)
+		}
+		return text
+	}
+	if blockTags[n.Data] {
+		return " " + c.inlineText(n) + " "
+	}
+	return c.inlineText(n)
+}
+
+func (c *markdownConverter) image(n *html.Node) string {
+	src := attr(n, "src")
+	if src == "" {
+		if srcset := parseSrcset(attr(n, "srcset")); len(srcset) > 0 {
+			src = srcset[0]
+		}
+	}
+	path, ok := c.assets[src]
+	if !ok {
+		path = src
+	}
+	if path == "" {
+		return ""
+	}
+	image := fmt.Sprintf("![%s](%s)", attr(n, "alt"), path)
+	if description := c.descriptions[path]; description != "" {
+		image += fmt.Sprintf(" [Opis obrazu: %s]", collapseSpaces(description))
+	}
+	return image
+}
+
+// media renders audio and video as a placeholder pointing to the local file,
+// the content itself is sent to the model separately.
+func (c *markdownConverter) media(n *html.Node) string {
+	src := attr(n, "src")
+	for child := n.FirstChild; child != nil && src == ""; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.Data == "source" {
+			src = attr(child, "src")
+		}
+	}
+	path, ok := c.assets[src]
+	if !ok {
+		path = src
+	}
+	kind := "Dźwięk"
+	if n.Data == "video" {
+		kind = "Wideo"
+	}
+	placeholder := fmt.Sprintf("[%s: %s]", kind, path)
+	if transcript := c.descriptions[path]; transcript != "" {
+		placeholder += fmt.Sprintf(" [Transkrypcja: %s]", collapseSpaces(transcript))
+	}
+	return placeholder
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(textContent(child))
+	}
+	return b.String()
+}
+
+func wrap(marker string, text string) string {
+	if text == "" {
+		return ""
+	}
+	return marker + text + marker
+}
+
+func collapseSpaces(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/generative-ai-go/genai"
+	"os"
+	"shared/retrieval"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const reportFile = "qa_report.json"
+
+type Citation struct {
+	Chunk string `json:"chunk"`
+	Quote string `json:"quote"`
+}
+
+// AnswerWithSources is the answer of the model together with the evidence it
+// used, the chunks the question retrieved and the result of the consistency check.
+type AnswerWithSources struct {
+	ID         string     `json:"id"`
+	Question   string     `json:"question"`
+	Answer     string     `json:"answer"`
+	Citations  []Citation `json:"citations"`
+	Media      []string   `json:"media,omitempty"`
+	Retrieved  []string   `json:"retrieved"`
+	Consistent bool       `json:"consistent"`
+	Issues     []string   `json:"issues,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func answerSchema() *genai.Schema {
+	return &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"answer": {Type: genai.TypeString, Description: "krótka odpowiedź na pytanie"},
+			"citations": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"chunk": {Type: genai.TypeString, Description: "identyfikator fragmentu, np. chunk-001"},
+						"quote": {Type: genai.TypeString, Description: "dokładny cytat z fragmentu potwierdzający odpowiedź"},
+					},
+					Required: []string{"chunk", "quote"},
+				},
+			},
+			"media": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}, Description: "nazwy plików obrazów i nagrań użytych do odpowiedzi"},
+		},
+		Required: []string{"answer", "citations"},
+	}
+}
+
+func citationsPrompt() genai.Text {
+	return "Odpowiedz obiektem JSON {\"answer\": \"<odpowiedź>\", \"citations\": [{\"chunk\": \"<id fragmentu>\", \"quote\": \"<dokładny cytat>\"}], \"media\": [\"<nazwa pliku>\"]}. " +
+		"W citations podaj fragmenty z których pochodzi odpowiedź i cytaty przepisane z nich dosłownie, w media pliki obrazów i nagrań jeśli odpowiedź pochodzi z nich."
+}
+
+func parseAnswer(id string, question string, resp string, hits []retrieval.Hit) (*AnswerWithSources, error) {
+	entry := AnswerWithSources{ID: id, Question: question}
+	if err := json.Unmarshal([]byte(resp), &entry); err != nil {
+		return nil, fmt.Errorf("error: answer is not a valid JSON object: %v", err)
+	}
+	entry.Answer = strings.TrimSpace(entry.Answer)
+	for _, hit := range hits {
+		entry.Retrieved = append(entry.Retrieved, hit.ID)
+	}
+	entry.Issues = checkConsistency(&entry, hits)
+	entry.Consistent = len(entry.Issues) == 0
+	return &entry, nil
+}
+
+// checkConsistency flags citations of chunks which were not retrieved, quotes
+// which are not in the cited chunk and answers which the cited evidence does
+// not contain. Answers taken from media can not be verified against text.
+func checkConsistency(entry *AnswerWithSources, hits []retrieval.Hit) []string {
+	var issues []string
+	if entry.Answer == "" {
+		issues = append(issues, "empty answer")
+	}
+
+	var evidence []string
+	for _, citation := range entry.Citations {
+		i := slices.IndexFunc(hits, func(hit retrieval.Hit) bool { return hit.ID == citation.Chunk })
+		if i < 0 {
+			issues = append(issues, fmt.Sprintf("cited chunk %s was not retrieved", citation.Chunk))
+			continue
+		}
+		if !strings.Contains(normalizeText(hits[i].Text), normalizeText(citation.Quote)) {
+			issues = append(issues, fmt.Sprintf("quote %q not found in %s", citation.Quote, citation.Chunk))
+			continue
+		}
+		evidence = append(evidence, citation.Quote)
+	}
+
+	if len(entry.Citations) == 0 && len(entry.Media) == 0 {
+		issues = append(issues, "no evidence cited")
+	}
+	if len(evidence) > 0 && len(entry.Media) == 0 && !containsAnswer(strings.Join(evidence, " "), entry.Answer) {
+		issues = append(issues, fmt.Sprintf("answer %q not found in the cited evidence", entry.Answer))
+	}
+	return issues
+}
+
+// containsAnswer checks that every word of the answer is in the evidence, the
+// endings of longer words are ignored so inflected Polish forms still match.
+func containsAnswer(evidence string, answer string) bool {
+	evidence = normalizeText(evidence)
+	for _, word := range strings.Fields(normalizeText(answer)) {
+		stem := []rune(word)
+		if len(stem) > 5 {
+			stem = stem[:len(stem)-2]
+		}
+		if !strings.Contains(evidence, string(stem)) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func saveReport(entries []*AnswerWithSources) error {
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(reportFile, content, 0o644); err != nil {
+		return fmt.Errorf("error: could not write %s: %v", reportFile, err)
+	}
+	return nil
+}
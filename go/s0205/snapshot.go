@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	snapshotManifest = "manifest.json"
+	snapshotPage     = "page.html"
+)
+
+// Snapshot describes a page captured together with its assets, so the article
+// can be indexed again without network access and with the same result.
+type Snapshot struct {
+	URL        string    `json:"url"`
+	Page       string    `json:"page"`
+	CapturedAt time.Time `json:"captured_at"`
+	Assets     []Asset   `json:"assets"`
+}
+
+// captureSnapshot downloads the page and every asset once into dir. The
+// snapshot is written to a temporary directory first, so a failed capture
+// does not replace a working snapshot.
+func captureSnapshot(pageURL string, dir string) error {
+	resp, err := http.Get(pageURL)
+	if err != nil {
+		return fmt.Errorf("error: getting article failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error: status %d %s", resp.StatusCode, resp.Status)
+	}
+	page, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error: reading article failed: %v", err)
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return fmt.Errorf("error: html parsing failed: %v", err)
+	}
+
+	tmpDir := dir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return fmt.Errorf("error: could not create directory %s: %v", tmpDir, err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, snapshotPage), page, 0o644); err != nil {
+		return err
+	}
+
+	snapshot := Snapshot{URL: resp.Request.URL.String(), Page: snapshotPage, CapturedAt: time.Now()}
+	refs, err := discoverAssets(doc, snapshot.URL)
+	if err != nil {
+		return err
+	}
+	downloaded := make(map[string]bool)
+	usedNames := make(map[string]string)
+	for _, ref := range refs {
+		if downloaded[ref.url] {
+			continue
+		}
+		name := assetName(ref.url, ref.kind, usedNames)
+		if err := downloadFile(ref.url, filepath.Join(tmpDir, assetDirs[ref.kind]), name); err != nil {
+			log.Printf("error: could not fetch %s %s: %v", ref.kind, ref.url, err)
+			continue
+		}
+		downloaded[ref.url] = true
+		snapshot.Assets = append(snapshot.Assets, Asset{URL: ref.url, Kind: ref.kind, Path: filepath.Join(assetDirs[ref.kind], name)})
+		log.Printf("file saved %s", filepath.Join(dir, assetDirs[ref.kind], name))
+	}
+
+	content, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, snapshotManifest), content, 0o644); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, dir)
+}
+
+// openSnapshot parses the captured page and maps the raw src attributes of its
+// media to the files in the snapshot.
+func openSnapshot(dir string) (*goquery.Document, map[string]string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, snapshotManifest))
+	if err != nil {
+		return nil, nil, err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return nil, nil, fmt.Errorf("error: could not parse snapshot manifest: %v", err)
+	}
+
+	page, err := os.ReadFile(filepath.Join(dir, snapshot.Page))
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error: html parsing failed: %v", err)
+	}
+
+	files := make(map[string]string)
+	for _, asset := range snapshot.Assets {
+		files[asset.URL] = filepath.Join(dir, asset.Path)
+	}
+	refs, err := discoverAssets(doc, snapshot.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	assets := make(map[string]string)
+	for _, ref := range refs {
+		if file, ok := files[ref.url]; ok {
+			for _, raw := range ref.refs {
+				assets[raw] = file
+			}
+		}
+	}
+	return doc, assets, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"shared/polish"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Check is a single term the keywords of a report should cover.
+type Check struct {
+	Term    string `json:"term"`
+	Kind    string `json:"kind"`
+	Reason  string `json:"reason"`
+	Covered bool   `json:"covered"`
+}
+
+type Coverage struct {
+	File     string   `json:"file"`
+	Keywords int      `json:"keywords"`
+	Checks   []Check  `json:"checks"`
+	Missing  []string `json:"missing,omitempty"`
+}
+
+// evaluateTags checks that the keywords of every report name the profession
+// of each person in the report and its linked facts, the sector from the file
+// name and the required terms mentioned in the report or its linked facts.
+func evaluateTags(tags map[string]string, graph *EntityGraph, facts map[string]string, required []string, lemmatizer *polish.Lemmatizer) []Coverage {
+	var names []string
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var report []Coverage
+	for _, name := range names {
+		keywords := strings.Split(tags[name], ",")
+		coverage := Coverage{File: name, Keywords: len(keywords)}
+		add := func(term string, kind string, reason string) {
+			term = polish.Normalize(term)
+			if term == "" || slices.ContainsFunc(coverage.Checks, func(c Check) bool { return c.Term == term }) {
+				return
+			}
+			check := Check{Term: term, Kind: kind, Reason: reason, Covered: covers(keywords, term, lemmatizer)}
+			coverage.Checks = append(coverage.Checks, check)
+			if !check.Covered {
+				coverage.Missing = append(coverage.Missing, term)
+			}
+		}
+
+		reportID := nodeID(KindReport, name)
+		people := graph.Mentions(reportID, KindPerson)
+		for _, link := range graph.Links[name] {
+			people = append(people, graph.Mentions(nodeID(KindFact, link.Fact), KindPerson)...)
+		}
+		for _, person := range people {
+			for _, profession := range graph.Professions(person.ID) {
+				add(profession, KindProfession, "profession of "+person.Name)
+			}
+		}
+		for _, sector := range sectorFromFileName(name) {
+			add(sector, KindSector, "sector from the file name")
+		}
+
+		// required terms matter only where the report or its linked facts mention them
+		content, _ := os.ReadFile(fmt.Sprintf("%s/%s", rootDir, name))
+		mentioned := polish.Normalize(string(content))
+		for _, link := range graph.Links[name] {
+			mentioned += " " + polish.Normalize(facts[link.Fact])
+		}
+		var entities []string
+		for _, entity := range graph.Mentions(reportID, linkKinds...) {
+			entities = append(entities, entity.ID)
+		}
+		for _, term := range required {
+			term = polish.Normalize(term)
+			if term != "" && (strings.Contains(" "+mentioned+" ", " "+term+" ") || slices.Contains(entities, nodeID(KindPerson, term))) {
+				add(term, "required", "required term mentioned in the report or its facts")
+			}
+		}
+		report = append(report, coverage)
+	}
+	return report
+}
+
+// covers reports whether any keyword is the term or contains it as whole
+// words, comparing the nominative forms.
+func covers(keywords []string, term string, lemmatizer *polish.Lemmatizer) bool {
+	if lemma, ok := lemmatizer.Lemma(term); ok {
+		term = lemma
+	}
+	for _, keyword := range keywords {
+		keyword = polish.Normalize(keyword)
+		if lemma, ok := lemmatizer.Lemma(keyword); ok {
+			keyword = lemma
+		}
+		if strings.Contains(" "+keyword+" ", " "+term+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func saveCoverage(path string, report []Coverage) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o644)
+}
+
+func printCoverage(report []Coverage) {
+	for _, coverage := range report {
+		covered := len(coverage.Checks) - len(coverage.Missing)
+		log.Printf("| %s | %d keywords | %d/%d terms covered | missing: %v", coverage.File, coverage.Keywords, covered, len(coverage.Checks), coverage.Missing)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/openai/openai-go"
+	"log"
+	"os"
+	"shared/batch"
+	"shared/retrieval"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	KindReport     = "report"
+	KindFact       = "fact"
+	KindPerson     = "person"
+	KindPlace      = "place"
+	KindProfession = "profession"
+	KindSector     = "sector"
+)
+
+// linkKinds are the entities through which a report is linked to a fact.
+var linkKinds = []string{KindPerson, KindPlace, KindSector}
+
+type Person struct {
+	Name       string `json:"name"`
+	Profession string `json:"profession"`
+}
+
+// Entities are the named entities extracted from a single file.
+type Entities struct {
+	People      []Person `json:"people"`
+	Places      []string `json:"places"`
+	Professions []string `json:"professions"`
+	Sectors     []string `json:"sectors"`
+}
+
+type Node struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+type Edge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Relation string `json:"relation"`
+}
+
+// FactLink explains why a fact was linked to a report.
+type FactLink struct {
+	Fact   string   `json:"fact"`
+	Shared []string `json:"shared"`
+}
+
+// EntityGraph connects reports and facts (documents) with the entities they
+// mention and people with their professions.
+type EntityGraph struct {
+	Nodes map[string]Node       `json:"nodes"`
+	Edges []Edge                `json:"edges"`
+	Links map[string][]FactLink `json:"links"`
+}
+
+func NewEntityGraph() *EntityGraph {
+	return &EntityGraph{Nodes: make(map[string]Node), Links: make(map[string][]FactLink)}
+}
+
+func nodeID(kind string, name string) string {
+	return kind + ":" + normalizeEntity(name)
+}
+
+func normalizeEntity(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func (g *EntityGraph) addNode(kind string, name string) string {
+	id := nodeID(kind, name)
+	if _, ok := g.Nodes[id]; !ok {
+		g.Nodes[id] = Node{ID: id, Kind: kind, Name: strings.Join(strings.Fields(name), " ")}
+	}
+	return id
+}
+
+func (g *EntityGraph) addEdge(from string, to string, relation string) {
+	edge := Edge{From: from, To: to, Relation: relation}
+	if !slices.Contains(g.Edges, edge) {
+		g.Edges = append(g.Edges, edge)
+	}
+}
+
+// AddDocument adds the report or fact with the entities it mentions.
+func (g *EntityGraph) AddDocument(kind string, name string, entities Entities) {
+	doc := g.addNode(kind, name)
+	for _, person := range entities.People {
+		if strings.TrimSpace(person.Name) == "" {
+			continue
+		}
+		id := g.addNode(KindPerson, person.Name)
+		g.addEdge(doc, id, "mentions")
+		if strings.TrimSpace(person.Profession) != "" {
+			profession := g.addNode(KindProfession, person.Profession)
+			g.addEdge(id, profession, "works_as")
+		}
+	}
+	mentions := []struct {
+		kind  string
+		names []string
+	}{{KindPlace, entities.Places}, {KindProfession, entities.Professions}, {KindSector, entities.Sectors}}
+	for _, mention := range mentions {
+		for _, name := range mention.names {
+			if strings.TrimSpace(name) != "" {
+				g.addEdge(doc, g.addNode(mention.kind, name), "mentions")
+			}
+		}
+	}
+}
+
+// Mentions returns the entities of the given kinds mentioned by the document.
+func (g *EntityGraph) Mentions(docID string, kinds ...string) []Node {
+	var nodes []Node
+	for _, edge := range g.Edges {
+		if edge.From == docID && edge.Relation == "mentions" && slices.Contains(kinds, g.Nodes[edge.To].Kind) {
+			nodes = append(nodes, g.Nodes[edge.To])
+		}
+	}
+	return nodes
+}
+
+// Professions returns the professions of the person.
+func (g *EntityGraph) Professions(personID string) []string {
+	var professions []string
+	for _, edge := range g.Edges {
+		if edge.From == personID && edge.Relation == "works_as" {
+			professions = append(professions, g.Nodes[edge.To].Name)
+		}
+	}
+	return professions
+}
+
+// Link finds the facts sharing a person, place or sector with the report,
+// the facts sharing more entities come first.
+func (g *EntityGraph) Link(report string) []FactLink {
+	shared := make(map[string][]string)
+	for _, entity := range g.Mentions(nodeID(KindReport, report), linkKinds...) {
+		for _, edge := range g.Edges {
+			if edge.To == entity.ID && edge.Relation == "mentions" && g.Nodes[edge.From].Kind == KindFact {
+				fact := g.Nodes[edge.From].Name
+				shared[fact] = append(shared[fact], entity.ID)
+			}
+		}
+	}
+
+	var links []FactLink
+	for fact, entities := range shared {
+		links = append(links, FactLink{Fact: fact, Shared: entities})
+	}
+	slices.SortFunc(links, func(a, b FactLink) int {
+		if c := cmp.Compare(len(b.Shared), len(a.Shared)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Fact, b.Fact)
+	})
+	g.Links[report] = links
+	return links
+}
+
+func (g *EntityGraph) Save(path string) error {
+	content, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o644)
+}
+
+// extractEntities asks the model for the entities of the file, the result is
+// kept in the checkpoint so unchanged files are not sent again.
+func extractEntities(ctx context.Context, client *openai.Client, checkpoint *batch.Checkpoint, path string, fileName string, fileContent []byte) (Entities, error) {
+	var entities Entities
+	key := "entities:" + path
+	found, err := checkpoint.Lookup(key, fileContent, &entities)
+	if err != nil {
+		log.Printf("warning: ignoring checkpoint of %s: %v", fileName, err)
+	} else if found {
+		return entities, nil
+	}
+
+	resp, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{prepareEntitiesMessage(), prepareUserMessage(fileName, string(fileContent))}),
+		Model:    openai.F(openai.ChatModelGPT4oMini),
+		ResponseFormat: openai.F[openai.ChatCompletionNewParamsResponseFormatUnion](openai.ChatCompletionNewParamsResponseFormat{
+			Type: openai.F(openai.ChatCompletionNewParamsResponseFormatTypeJSONObject),
+		}),
+	})
+	if err != nil {
+		return entities, fmt.Errorf("could not extract entities of %s: %v", fileName, err)
+	}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &entities); err != nil {
+		return entities, fmt.Errorf("could not parse entities of %s: %v", fileName, err)
+	}
+	if err := checkpoint.Save(key, fileContent, entities); err != nil {
+		log.Printf("warning: %v", err)
+	}
+	time.Sleep(5 * time.Second)
+	return entities, nil
+}
+
+// buildEntityGraph extracts the entities of the fact files and the reports.
+func buildEntityGraph(ctx context.Context, client *openai.Client, checkpoint *batch.Checkpoint, reports []os.DirEntry) (*EntityGraph, error) {
+	graph := NewEntityGraph()
+	factsDir := rootDir + "/facts"
+	factFiles, err := os.ReadDir(factsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	add := func(kind string, dir string, files []os.DirEntry) error {
+		for _, file := range files {
+			if !isTextFile(file) {
+				continue
+			}
+			path := fmt.Sprintf("%s/%s", dir, file.Name())
+			fileContent, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			entities, err := extractEntities(ctx, client, checkpoint, path, file.Name(), fileContent)
+			if err != nil {
+				return err
+			}
+			if kind == KindReport {
+				entities.Sectors = append(entities.Sectors, sectorFromFileName(file.Name())...)
+			}
+			graph.AddDocument(kind, file.Name(), entities)
+		}
+		return nil
+	}
+	if err := add(KindFact, factsDir, factFiles); err != nil {
+		return nil, err
+	}
+	if err := add(KindReport, rootDir, reports); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+// fileMetadata reads the date, sector and report number from report names like
+// 2024-11-12_report-00-sektor_C4.txt.
+var fileMetadata = retrieval.NewMetadataExtractor()
+
+func sectorFromFileName(name string) []string {
+	sector, ok := fileMetadata.FromFileName(name)["sector"]
+	if !ok {
+		return nil
+	}
+	return []string{"sektor " + sector}
+}
+
+// describeFileName lists the metadata of the file name in parentheses, so the
+// model does not have to parse it.
+func describeFileName(name string) string {
+	metadata := fileMetadata.FromFileName(name)
+	var parts []string
+	for _, key := range []string{"date", "report", "sector"} {
+		if value, ok := metadata[key]; ok {
+			parts = append(parts, fmt.Sprintf("%s: %s", key, value))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+func prepareEntitiesMessage() openai.ChatCompletionMessageParam {
+	return openai.ChatCompletionMessageParam{
+		Role: openai.F(openai.ChatCompletionMessageParamRole("system")),
+		Content: openai.F[interface{}]("" +
+			"Extract the named entities from the file. Answer with JSON object " +
+			"{\"people\": [{\"name\": \"<first name and surname>\", \"profession\": \"<profession or empty>\"}], \"places\": [\"<place>\"], \"professions\": [\"<profession>\"], \"sectors\": [\"<sector, e.g. sektor C4>\"]}. " +
+			"All values in Polish and in the nominative case (mianownik), names of people with the first name and the surname when known.",
+		),
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/openai/openai-go"
+	"log"
+	"os"
+	"shared/polish"
+	"slices"
+	"strings"
+)
+
+const minKeywords = 15
+
+// KeywordNormalizer turns the comma separated keywords of the model into
+// lowercase nominative phrases without forbidden signs. Phrases missing in the
+// dictionary are sent to the model and the answers are kept in learnedPath.
+type KeywordNormalizer struct {
+	lemmatizer  *polish.Lemmatizer
+	client      *openai.Client
+	learnedPath string
+}
+
+func newKeywordNormalizer(client *openai.Client, dictionaryPath string, learnedPath string) (*KeywordNormalizer, error) {
+	lemmatizer := polish.NewLemmatizer()
+	for _, path := range []string{dictionaryPath, learnedPath} {
+		if path == "" {
+			continue
+		}
+		if err := lemmatizer.LoadDictionary(path); err != nil {
+			return nil, err
+		}
+	}
+	return &KeywordNormalizer{lemmatizer: lemmatizer, client: client, learnedPath: learnedPath}, nil
+}
+
+func (n *KeywordNormalizer) Normalize(ctx context.Context, tags string) ([]string, error) {
+	var phrases []string
+	var unknown []string
+	for _, tag := range strings.Split(tags, ",") {
+		phrase := polish.Normalize(tag)
+		if phrase == "" {
+			continue
+		}
+		phrases = append(phrases, phrase)
+		if _, ok := n.lemmatizer.Lemma(phrase); !ok && !slices.Contains(unknown, phrase) {
+			unknown = append(unknown, phrase)
+		}
+	}
+
+	if len(unknown) > 0 && n.client != nil {
+		if err := n.learn(ctx, unknown); err != nil {
+			log.Printf("warning: keywords left as they are: %v", err)
+		}
+	}
+
+	var keywords []string
+	for _, phrase := range phrases {
+		if lemma, ok := n.lemmatizer.Lemma(phrase); ok {
+			phrase = lemma
+		}
+		if !slices.Contains(keywords, phrase) {
+			keywords = append(keywords, phrase)
+		}
+	}
+	return keywords, nil
+}
+
+// learn asks the model for the nominative form of the phrases unknown to the dictionary.
+func (n *KeywordNormalizer) learn(ctx context.Context, phrases []string) error {
+	resp, err := n.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{prepareLemmaMessage(phrases)}),
+		Model:    openai.F(openai.ChatModelGPT4oMini),
+		ResponseFormat: openai.F[openai.ChatCompletionNewParamsResponseFormatUnion](openai.ChatCompletionNewParamsResponseFormat{
+			Type: openai.F(openai.ChatCompletionNewParamsResponseFormatTypeJSONObject),
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("could not lemmatize keywords: %v", err)
+	}
+	var lemmas map[string]string
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &lemmas); err != nil {
+		return fmt.Errorf("could not parse lemmas: %v", err)
+	}
+
+	var learned strings.Builder
+	for _, phrase := range phrases {
+		lemma := polish.Normalize(lemmas[phrase])
+		if lemma == "" {
+			continue
+		}
+		n.lemmatizer.Learn(phrase, lemma)
+		fmt.Fprintf(&learned, "%s\t%s\tllm\n", phrase, lemma)
+	}
+	if n.learnedPath == "" || learned.Len() == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(n.learnedPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(learned.String())
+	return err
+}
+
+func prepareLemmaMessage(phrases []string) openai.ChatCompletionMessageParam {
+	return openai.ChatCompletionMessageParam{
+		Role: openai.F(openai.ChatCompletionMessageParamRole("user")),
+		Content: openai.F[interface{}]("" +
+			"Convert every Polish phrase below to the nominative case (mianownik), keep the number and the word order, lowercase. " +
+			"Answer with JSON object mapping the phrase exactly as given to its nominative form.\n" + strings.Join(phrases, "\n"),
+		),
+	}
+}
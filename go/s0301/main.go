@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/openai/openai-go"
@@ -12,6 +13,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"shared/batch"
+	"shared/polish"
+	"shared/transcribe"
+	"slices"
 	"strings"
 	"time"
 )
@@ -25,6 +30,15 @@ type FinalAnswer struct {
 }
 
 func main() {
+	checkpointPath := flag.String("checkpoint", "checkpoint.jsonl", "file with already tagged reports, unchanged reports are skipped on the next run")
+	graphPath := flag.String("graph", "graph.json", "file where the entity graph linking reports to facts is saved")
+	dictionaryPath := flag.String("dictionary", "", "PoliMorf dictionary (form, lemma, tags separated by tabs) used besides the bundled one")
+	learnedPath := flag.String("lemmas", "lemmas.tsv", "file with the nominative forms returned by the model, reused on the next run")
+	evaluate := flag.Bool("evaluate", false, "write the keyword coverage report instead of submitting the tags")
+	coveragePath := flag.String("coverage", "coverage.json", "file where the keyword coverage report is saved")
+	required := flag.String("require", "barbara zawadzka", "comma separated terms which must be in the keywords of reports mentioning them")
+	flag.Parse()
+
 	ctx := context.Background()
 	err := godotenv.Load("../../.env")
 
@@ -41,47 +55,144 @@ func main() {
 		log.Fatal(err)
 	}
 
-	reportsTags := assigneTags(reportFiles, rootDir, getFactFilesContent(), ctx, openaiClient)
+	checkpoint, err := batch.OpenCheckpoint(*checkpointPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer checkpoint.Close()
+
+	graph, err := buildEntityGraph(ctx, openaiClient, checkpoint, reportFiles)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	normalizer, err := newKeywordNormalizer(openaiClient, *dictionaryPath, *learnedPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	facts := getFactFiles()
+	reportsTags := assigneTags(reportFiles, rootDir, graph, facts, normalizer, ctx, openaiClient, checkpoint)
+
+	if err := graph.Save(*graphPath); err != nil {
+		log.Printf("warning: could not save graph: %v", err)
+	}
 
 	log.Println(reportsTags)
 
+	if *evaluate {
+		coverage := evaluateTags(reportsTags, graph, facts, strings.Split(*required, ","), normalizer.lemmatizer)
+		printCoverage(coverage)
+		if err := saveCoverage(*coveragePath, coverage); err != nil {
+			log.Fatalf("could not save coverage report: %v", err)
+		}
+		return
+	}
+
+	var tooFew []string
+	for name, tags := range reportsTags {
+		if count := len(strings.Split(tags, ",")); count < minKeywords {
+			tooFew = append(tooFew, fmt.Sprintf("%s (%d)", name, count))
+		}
+	}
+	if len(tooFew) > 0 {
+		log.Fatalf("not submitting, reports with less than %d keywords: %v", minKeywords, tooFew)
+	}
+
 	sendResult(reportsTags)
 }
 
-func getFactFilesContent() string {
+// isTextFile reports whether the file is a report or a fact. The transcripts
+// cached by s0204 next to the audio and image files are left out.
+func isTextFile(file os.DirEntry) bool {
+	return !file.IsDir() && strings.HasSuffix(file.Name(), ".txt") && !transcribe.IsArtifact(file.Name())
+}
+
+func getFactFiles() map[string]string {
 	factsDir := rootDir + "/facts"
 	factFiles, err := os.ReadDir(factsDir)
 	if err != nil {
 		log.Fatal(err)
 	}
-	merged := ""
+	facts := make(map[string]string)
 	for _, file := range factFiles {
-		if !file.IsDir() && strings.Contains(file.Name(), ".txt") {
+		if isTextFile(file) {
 			fileContent, err := os.ReadFile(fmt.Sprintf("%s/%s", factsDir, file.Name()))
 			if err != nil {
 				panic(err)
 			}
-			merged = merged + fmt.Sprintf("\nFact file name: `%s` | Fact file content: `%s`", file.Name(), string(fileContent))
+			facts[file.Name()] = string(fileContent)
 		}
 	}
+	return facts
+}
+
+// linkedFactsContent returns only the facts linked to the report in the graph
+// together with the entities which link them.
+func linkedFactsContent(graph *EntityGraph, report string, facts map[string]string) string {
+	merged := ""
+	for _, link := range graph.Link(report) {
+		merged = merged + fmt.Sprintf("\nFact file name: `%s` | Linked by: `%s` | Fact file content: `%s`", link.Fact, strings.Join(link.Shared, ", "), facts[link.Fact])
+	}
 	return merged
 }
 
-func assigneTags(files []os.DirEntry, rootDir string, factsFilesContent string, ctx context.Context, client *openai.Client) map[string]string {
+func assigneTags(files []os.DirEntry, rootDir string, graph *EntityGraph, facts map[string]string, normalizer *KeywordNormalizer, ctx context.Context, client *openai.Client, checkpoint *batch.Checkpoint) map[string]string {
 	tags := make(map[string]string)
 	for _, file := range files {
-		if !file.IsDir() && strings.Contains(file.Name(), ".txt") {
-			fileContent, err := os.ReadFile(fmt.Sprintf("%s/%s", rootDir, file.Name()))
+		if isTextFile(file) {
+			path := fmt.Sprintf("%s/%s", rootDir, file.Name())
+			fileContent, err := os.ReadFile(path)
 			if err != nil {
 				panic(err)
 			}
-			responseTags, err := callModel(file.Name(), string(fileContent), factsFilesContent, ctx, client)
+			factsFilesContent := linkedFactsContent(graph, file.Name(), facts)
+			log.Printf("| %s | linked facts: %v", file.Name(), graph.Links[file.Name()])
+			// the linked facts are part of the prompt, so a change of them invalidates the tags
+			checkpointContent := append(fileContent, factsFilesContent...)
+			var responseTags string
+			found, err := checkpoint.Lookup(path, checkpointContent, &responseTags)
 			if err != nil {
 				log.Fatalln(err)
 			}
+
+			feedback := ""
+			generated := false
+			for attempt := 1; ; attempt++ {
+				if !found {
+					responseTags, err = callModel(file.Name(), string(fileContent), factsFilesContent, feedback, ctx, client)
+					if err != nil {
+						log.Fatalln(err)
+					}
+					generated = true
+					time.Sleep(5 * time.Second)
+				}
+				keywords, err := normalizer.Normalize(ctx, responseTags)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				// the sector is known from the file name, the model is not trusted to copy it
+				for _, sector := range sectorFromFileName(file.Name()) {
+					if sector = polish.Normalize(sector); !slices.Contains(keywords, sector) {
+						log.Printf("| %s | adding missing keyword %s", file.Name(), sector)
+						keywords = append(keywords, sector)
+					}
+				}
+				responseTags = strings.Join(keywords, ",")
+				if len(keywords) >= minKeywords || attempt == 2 {
+					break
+				}
+				found = false
+				feedback = fmt.Sprintf("Your answer `%s` contains only %d different keywords, generate at least %d.", responseTags, len(keywords), minKeywords)
+				log.Printf("| %s | %s", file.Name(), feedback)
+			}
+			if generated {
+				if err := checkpoint.Save(path, checkpointContent, responseTags); err != nil {
+					log.Printf("warning: %v", err)
+				}
+			}
 			log.Printf("| %s | %s", file.Name(), responseTags)
 			tags[file.Name()] = responseTags
-			time.Sleep(5 * time.Second)
 		}
 	}
 	return tags
@@ -124,9 +235,13 @@ func sendResult(tags map[string]string) {
 	log.Printf(string(bytesBody))
 }
 
-func callModel(fileName string, fileContent string, factsFilesContent string, ctx context.Context, client *openai.Client) (string, error) {
+func callModel(fileName string, fileContent string, factsFilesContent string, feedback string, ctx context.Context, client *openai.Client) (string, error) {
+	messages := []openai.ChatCompletionMessageParamUnion{prepareSystemMessage(factsFilesContent), prepareUserMessage(fileName, fileContent)}
+	if feedback != "" {
+		messages = append(messages, openai.UserMessage(feedback))
+	}
 	resp, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{prepareSystemMessage(factsFilesContent), prepareUserMessage(fileName, fileContent)}),
+		Messages: openai.F(messages),
 		Model:    openai.F(openai.ChatModelGPT4oMini),
 	})
 	if err != nil {
@@ -145,9 +260,9 @@ func prepareSystemMessage(factsFilesContent string) openai.ChatCompletionMessage
 			"You need to analyzed the content of the file and generate based on the file content the keywords (in denominator), which then will help to group the files." +
 			"During keywords generation take into account the name of the directory in which files are located as well as the file name." +
 			"While generating keywords for reports you need to take into account also the content of the Fact files which you can find below (the fact file has name like `f01.txt`, `f02.txt`... `f09.txt` etc." +
-			"You need bind the content of the report (if possible) with some fact file for example by person name / surname or location and then based on this generate keywords." +
+			"The Fact files below were linked with the report through the people, places and sectors they share (listed in `Linked by`), use them to generate keywords." +
 			"Answer need to be in Polish. The answer should contain only coma seperated denominators starting from small letter. For each report generate at least 15 keywords. When any person is mentioned in the report the keywords for the given report also should include the profession as keyword. Do not forget about keywords related to Barbara Zawadzka . The keywords should not contain additional signs like `-`, `_` etc. (only white space is allowed)." +
-			"The content of the Fact files can be found below: \n" + factsFilesContent,
+			"The content of the Fact files linked with the report can be found below: \n" + factsFilesContent,
 		),
 	}
 }
@@ -155,6 +270,6 @@ func prepareSystemMessage(factsFilesContent string) openai.ChatCompletionMessage
 func prepareUserMessage(fileName string, fileContent string) openai.ChatCompletionMessageParam {
 	return openai.ChatCompletionMessageParam{
 		Role:    openai.F(openai.ChatCompletionMessageParamRole("user")),
-		Content: openai.F[interface{}](fmt.Sprintf("File name: `%s`. File Content: \n %s", fileName, fileContent)),
+		Content: openai.F[interface{}](fmt.Sprintf("File name: `%s`%s. File Content: \n %s", fileName, describeFileName(fileName), fileContent)),
 	}
 }
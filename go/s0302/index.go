@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"shared/polish"
+	"shared/retrieval"
+	"strings"
+)
+
+// newEmbedder returns the embedder of the backend and the model name stored
+// in the index, so an index built by another backend is not reused.
+func newEmbedder(backend string, model string) (retrieval.Embedder, string, error) {
+	switch backend {
+	case "openai":
+		if model == "" {
+			model = "text-embedding-3-small"
+		}
+		return &retrieval.OpenAIEmbedder{BaseURL: "https://api.openai.com/v1", APIKey: os.Getenv("OPENAI_API_KEY"), Model: model}, "openai:" + model, nil
+	case "ollama":
+		if model == "" {
+			model = "nomic-embed-text"
+		}
+		return &retrieval.OllamaEmbedder{Host: os.Getenv("OLLAMA_HOST"), Model: model}, "ollama:" + model, nil
+	case "hash":
+		return &retrieval.HashEmbedder{Dimensions: 1024}, "hash:1024", nil
+	}
+	return nil, "", fmt.Errorf("unknown embedder %q, use openai, ollama or hash", backend)
+}
+
+func getReports(extractor *retrieval.MetadataExtractor) ([]retrieval.Document, error) {
+	files, err := os.ReadDir(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	var docs []retrieval.Document
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".txt") {
+			continue
+		}
+		fileContent, err := os.ReadFile(fmt.Sprintf("%s/%s", rootDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, extractor.Document(file.Name(), string(fileContent)))
+	}
+	return docs, nil
+}
+
+// validateAnswer checks that the answer is a date and that a report of that
+// day exists, the date of the report is read from its file name.
+func validateAnswer(answer string, reports []retrieval.Document) error {
+	dates := polish.FindDates(answer)
+	if len(dates) != 1 || dates[0].Value != answer {
+		return fmt.Errorf("answer %q is not a single YYYY-MM-DD date", answer)
+	}
+	for _, report := range reports {
+		if report.Metadata["date"] == answer {
+			return nil
+		}
+	}
+	return fmt.Errorf("there is no report from %s", answer)
+}
+
+// loadIndex reuses the persisted index when it was built by the same model
+// from the same reports, otherwise the reports are embedded again.
+func loadIndex(ctx context.Context, embedder retrieval.Embedder, model string, path string, docs []retrieval.Document, hnsw bool) (*retrieval.VectorIndex, error) {
+	if index, err := retrieval.LoadVectorIndex(path); err == nil && index.Matches(model, docs) && (index.Graph != nil) == hnsw {
+		return index, nil
+	}
+	index, err := retrieval.BuildVectorIndex(ctx, embedder, model, docs, 20)
+	if err != nil {
+		return nil, err
+	}
+	if hnsw {
+		index.BuildHNSW(16, 64, 1)
+	}
+	return index, index.Save(path)
+}
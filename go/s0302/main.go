@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/openai/openai-go"
@@ -12,6 +13,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"shared/polish"
+	"shared/qdrant"
+	"shared/retrieval"
 	"strings"
 )
 
@@ -31,35 +35,95 @@ func main() {
 		log.Fatalf("could not load env variables %v", err)
 	}
 
-	apiKey := os.Getenv("OPENAI_API_KEY")
-
-	openaiClient := openai.NewClient(option.WithAPIKey(apiKey))
+	backend := flag.String("embedder", "openai", "embedding backend: openai, ollama or hash (local, no model needed)")
+	model := flag.String("embedding-model", "", "embedding model, defaults to text-embedding-3-small for openai and nomic-embed-text for ollama")
+	indexPath := flag.String("index", "index.json", "file with the persisted vector index, reused while the reports do not change")
+	hnsw := flag.Bool("hnsw", true, "search the index through the HNSW graph instead of comparing with every report")
+	topK := flag.Int("top-k", 3, "number of reports printed for the question")
+	store := flag.String("store", "index", "where the reports are searched: index (the vector index file) or qdrant (the server at QDRANT_URL, or the embedded store when it is empty)")
+	collection := flag.String("collection", "reports", "qdrant collection of the reports")
+	qdrantDir := flag.String("qdrant-dir", "qdrant", "directory of the embedded qdrant store")
+	mode := flag.String("search", "hybrid", "how the reports are searched: hybrid (keywords and vectors fused), vector or keyword")
+	rerank := flag.Bool("rerank", false, "let gpt-4o-mini reorder the found reports by their relevance to the question")
+	var patterns []retrieval.FilePattern
+	flag.Func("file-pattern", "metadata read from the report names as key=regexp or key=template=regexp (e.g. date=${1}-${2}-${3}=(\\d{4})_(\\d{2})_(\\d{2})), repeatable, defaults to date, sector and report number", func(spec string) error {
+		pattern, err := retrieval.ParseFilePattern(spec)
+		patterns = append(patterns, pattern)
+		return err
+	})
+	filters := make(map[string]string)
+	flag.Func("filter", "search only the reports with the metadata key=value, e.g. dates=2024-01-08 for the reports mentioning the day, repeatable", func(spec string) error {
+		key, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			return fmt.Errorf("use key=value")
+		}
+		filters[key] = value
+		return nil
+	})
+	question := flag.String("question", "W raporcie, z którego dnia znajduje się wzmianka o kradzieży prototypu broni?", "question asked to the index")
+	flag.Parse()
 
-	finalDate, err := callModel(getFilesContent(), ctx, openaiClient)
+	embedder, modelName, err := newEmbedder(*backend, *model)
 	if err != nil {
-		log.Fatalf("something went wrong %s", err)
+		log.Fatalln(err)
 	}
-	log.Println(finalDate)
-	sendResult(finalDate)
-}
-
-func getFilesContent() string {
-	files, err := os.ReadDir(rootDir)
+	reports, err := getReports(retrieval.NewMetadataExtractor(patterns...))
+	if err != nil {
+		log.Fatalf("could not read reports: %v", err)
+	}
+	index, err := loadIndex(ctx, embedder, modelName, *indexPath, reports, *hnsw)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("could not index reports: %v", err)
 	}
-	merged := ""
-	for _, file := range files {
-		if !file.IsDir() && strings.Contains(file.Name(), ".txt") {
-			fileContent, err := os.ReadFile(fmt.Sprintf("%s/%s", rootDir, file.Name()))
-			if err != nil {
-				panic(err)
-			}
-			merged = merged + fmt.Sprintf("\nFile name: `%s` | File content: `%s`", file.Name(), string(fileContent))
+
+	searcher := &retrieval.HybridSearcher{Embedder: embedder}
+	var vectorStore retrieval.VectorStore = index
+	switch *store {
+	case "index":
+	case "qdrant":
+		qdrantStore, err := qdrant.Open(os.Getenv("QDRANT_URL"), os.Getenv("QDRANT_API_KEY"), *qdrantDir)
+		if err != nil {
+			log.Fatalf("could not open qdrant: %v", err)
 		}
+		collection := &qdrantReports{store: qdrantStore, collection: *collection}
+		if err := collection.upload(ctx, index); err != nil {
+			log.Fatalf("could not upload reports to qdrant: %v", err)
+		}
+		vectorStore = collection
+	default:
+		log.Fatalf("unknown store %q, use index or qdrant", *store)
+	}
+	keywords := retrieval.NewBM25Index(reports, retrieval.PolishAnalyzer(polish.NewLemmatizer()))
+	switch *mode {
+	case "hybrid":
+		searcher.Vector, searcher.Keywords = vectorStore, keywords
+	case "vector":
+		searcher.Vector = vectorStore
+	case "keyword":
+		searcher.Keywords = keywords
+	default:
+		log.Fatalf("unknown search %q, use hybrid, vector or keyword", *mode)
+	}
+	if *rerank {
+		searcher.Reranker = &retrieval.LLMReranker{Complete: completeWithModel(openai.NewClient(option.WithAPIKey(os.Getenv("OPENAI_API_KEY"))))}
+	}
+
+	hits, err := searcher.Search(ctx, *question, *topK, filters)
+	if err != nil {
+		log.Fatalf("could not search reports: %v", err)
+	}
+	for _, hit := range hits {
+		log.Printf("| %.4f | %s | %s", hit.Score, hit.Metadata["date"], hit.ID)
+	}
+	if len(hits) == 0 {
+		log.Fatalln("no report found for the question")
 	}
-	print(merged)
-	return merged
+	finalDate := hits[0].Metadata["date"]
+	if err := validateAnswer(finalDate, reports); err != nil {
+		log.Fatalf("not submitting: %v", err)
+	}
+	log.Println(finalDate)
+	sendResult(finalDate)
 }
 
 func sendResult(finalDate string) {
@@ -99,32 +163,19 @@ func sendResult(finalDate string) {
 	log.Printf(string(bytesBody))
 }
 
-func callModel(filesContent string, ctx context.Context, client *openai.Client) (string, error) {
-	resp, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{prepareSystemMessage(), prepareUserMessage(filesContent)}),
-		Model:    openai.F(openai.ChatModelGPT4oMini),
-	})
-	if err != nil {
-		log.Fatalf("Error while sending message: %v", err)
-		return "", err
-	}
-	answer := resp.Choices[0].Message.Content
-	return answer, nil
-}
-
-func prepareSystemMessage() openai.ChatCompletionMessageParam {
-	return openai.ChatCompletionMessageParam{
-		Role: openai.F(openai.ChatCompletionMessageParamRole("system")),
-		Content: openai.F[interface{}]("" +
-			"You are powerful assistant which needs the help me analyzed files. You will receive the files (file name and file contents) which you will need to analyse. The file name contains the date in which the report was prepared." +
-			"In report from which day there is information about the theft of a weapon prototype, please provide the answer which is only the date when it happens. The date should be in format YYYY-MM-DD",
-		),
-	}
-}
-
-func prepareUserMessage(fileContent string) openai.ChatCompletionMessageParam {
-	return openai.ChatCompletionMessageParam{
-		Role:    openai.F(openai.ChatCompletionMessageParamRole("user")),
-		Content: openai.F[interface{}](fmt.Sprintf("Files content: \n %s", fileContent)),
+// completeWithModel sends the prompt of the reranker to gpt-4o-mini.
+func completeWithModel(client *openai.Client) func(ctx context.Context, prompt string) (string, error) {
+	return func(ctx context.Context, prompt string) (string, error) {
+		resp, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: openai.F([]openai.ChatCompletionMessageParamUnion{openai.UserMessage(prompt)}),
+			Model:    openai.F(openai.ChatModelGPT4oMini),
+			ResponseFormat: openai.F[openai.ChatCompletionNewParamsResponseFormatUnion](openai.ChatCompletionNewParamsResponseFormat{
+				Type: openai.F(openai.ChatCompletionNewParamsResponseFormatTypeJSONObject),
+			}),
+		})
+		if err != nil {
+			return "", err
+		}
+		return resp.Choices[0].Message.Content, nil
 	}
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"shared/qdrant"
+	"shared/retrieval"
+	"strings"
+)
+
+// qdrantReports searches the reports in a Qdrant collection, the report name
+// and its metadata are kept in the payload.
+type qdrantReports struct {
+	store      qdrant.Store
+	collection string
+}
+
+// upload recreates the collection and upserts the embedded reports of the
+// index, so another embedder or removed reports leave no stale points behind.
+func (q *qdrantReports) upload(ctx context.Context, index *retrieval.VectorIndex) error {
+	if len(index.Entries) == 0 {
+		return nil
+	}
+	if err := q.store.DeleteCollection(ctx, q.collection); err != nil {
+		return err
+	}
+	params := qdrant.VectorParams{Size: len(index.Entries[0].Vector), Distance: qdrant.DistanceCosine}
+	if err := q.store.CreateCollection(ctx, q.collection, params); err != nil {
+		return err
+	}
+	var points []qdrant.Point
+	for _, entry := range index.Entries {
+		payload := map[string]any{"id": entry.Document.ID, "text": entry.Document.Text}
+		for key, value := range entry.Document.Metadata {
+			payload[key] = value
+		}
+		// an array lets the dates be filtered one by one
+		if dates, ok := entry.Document.Metadata["dates"]; ok {
+			payload["dates"] = strings.Split(dates, ",")
+		}
+		points = append(points, qdrant.Point{ID: qdrant.PointID(entry.Document.ID), Vector: entry.Vector, Payload: payload})
+	}
+	return q.store.Upsert(ctx, q.collection, points)
+}
+
+func (q *qdrantReports) SearchVector(ctx context.Context, vector []float32, k int, filters map[string]string) ([]retrieval.Hit, error) {
+	req := qdrant.SearchRequest{Vector: vector, Limit: k, WithPayload: true}
+	if len(filters) > 0 {
+		req.Filter = &qdrant.Filter{}
+		for key, value := range filters {
+			req.Filter.Must = append(req.Filter.Must, qdrant.MatchValue(key, value))
+		}
+	}
+	found, err := q.store.Search(ctx, q.collection, req)
+	if err != nil {
+		return nil, err
+	}
+	var hits []retrieval.Hit
+	for _, point := range found {
+		doc := retrieval.Document{Metadata: make(map[string]string)}
+		for key, value := range point.Payload {
+			text, _ := value.(string)
+			if values, ok := value.([]any); ok {
+				var texts []string
+				for _, v := range values {
+					texts = append(texts, fmt.Sprint(v))
+				}
+				text = strings.Join(texts, ",")
+			}
+			switch key {
+			case "id":
+				doc.ID = text
+			case "text":
+				doc.Text = text
+			default:
+				doc.Metadata[key] = text
+			}
+		}
+		hits = append(hits, retrieval.Hit{Document: doc, Score: point.Score})
+	}
+	return hits, nil
+}
@@ -5,6 +5,7 @@ go 1.23.2
 require (
 	github.com/joho/godotenv v1.5.1
 	github.com/openai/openai-go v0.1.0-alpha.56
+	shared v0.0.0-00010101000000-000000000000
 )
 
 require (
@@ -13,3 +14,5 @@ require (
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
 )
+
+replace shared => ../shared
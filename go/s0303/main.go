@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
+	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/openai/openai-go"
@@ -13,9 +13,8 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"slices"
-	"strings"
-	"time"
+	"shared/agent"
+	"strconv"
 )
 
 type TableStructure struct {
@@ -27,26 +26,6 @@ type TableInBanana struct {
 	Table string `json:"Tables_in_banana"`
 }
 
-type User struct {
-	Id          string `json:"id"`
-	Username    string `json:"username"`
-	AccessLevel string `json:"access_level"`
-	IsActive    string `json:"is_active"`
-	LastLog     string `json:"lastlog"`
-}
-
-type Datacenter struct {
-	DCId     string `json:"dc_id"`
-	Location string `json:"location"`
-	Manager  string `json:"manager"`
-	IsActive string `json:"is_active"`
-}
-
-type Connection struct {
-	User1Id string `json:"user1_id"`
-	User2Id string `json:"user2_id"`
-}
-
 type DBResponse[T any] struct {
 	Reply []T    `json:"reply"`
 	Error string `json:"error"`
@@ -65,6 +44,10 @@ type FinalAnswer struct {
 }
 
 func main() {
+	maxSteps := flag.Int("max-steps", 15, "maximum number of model replies before giving up")
+	tokenBudget := flag.Int("token-budget", 100000, "maximum number of prompt and completion tokens used by the agent, 0 for no limit")
+	flag.Parse()
+
 	ctx := context.Background()
 	err := godotenv.Load("../../.env")
 
@@ -76,113 +59,28 @@ func main() {
 	aiDevsApiKey := os.Getenv("AI_DEVS_API_KEY")
 	openaiApiKey := os.Getenv("OPENAI_API_KEY")
 
-	tables := []string{"users", "datacenters", "connections"}
-	tablesStructure := getTablesStructure(host, aiDevsApiKey, tables)
-	users := getUsersData(host, aiDevsApiKey)
-	datacenters := getDatacentersData(host, aiDevsApiKey)
-	connections := getConnectionsData(host, aiDevsApiKey)
-
-	strTbStructures, _ := json.Marshal(tablesStructure)
-	strUsers, _ := json.Marshal(users)
-	strDCs, _ := json.Marshal(datacenters)
-	strConnections, _ := json.Marshal(connections)
-
-	systemMsg := prepareSystemMessage(string(strTbStructures), string(strUsers), string(strDCs), string(strConnections))
-
-	question := "Which active datacenters (DC_ID) are managed by employees which are on leave (is_active=0). The final response should contains only datacenters ID (DC_ID) and looks like -> answer: 123, 321, 111."
-	userMsg := prepareUserMessage(question)
-
-	modelMessages := []openai.ChatCompletionMessageParamUnion{systemMsg, userMsg}
-
-	openaiClient := openai.NewClient(option.WithAPIKey(openaiApiKey))
-	var finalResp string
-	for {
-		finalResp, err = callModel(ctx, openaiClient, modelMessages)
-		if err != nil {
-			log.Fatalf("something went wrong %s", err)
-		}
-		log.Println(fmt.Sprintf("resp -> %s ", finalResp))
-		if strings.Contains(finalResp, "query:") {
-			sqlQuery := strings.TrimSpace(strings.TrimPrefix(finalResp, "query:"))
-			dbResponse, err := callDbApi(host, aiDevsApiKey, sqlQuery)
-			if err != nil {
-				log.Fatalln("call DB API failed ", err)
-			}
-			modelMessages = append(modelMessages, prepareUserMessage(fmt.Sprintf("Additional Data: %s", dbResponse)))
-			time.Sleep(5 * time.Second)
-		} else {
-			break
-		}
-	}
-
-	log.Println(finalResp)
-
-	if strings.Contains(finalResp, "answer:") {
-		answer := strings.TrimSpace(strings.TrimPrefix(finalResp, "answer:"))
-		result := strings.Split(answer, ",")
-		sendResult(host, aiDevsApiKey, result)
-	} else {
-		log.Fatalln(fmt.Sprintf("unknown response type: %s", finalResp))
-	}
-}
-
-func getTablesStructure(host string, apiKey string, tables []string) *[]TableStructure {
-	var resp DBResponse[TableStructure]
-	var tablesStructure []TableStructure
-	for _, table := range tables {
-		query := "show create table " + table
-		bytesContent, err := callDbApi(host, apiKey, query)
-		if err != nil {
-			log.Fatalln(err)
-		}
-		if err := json.Unmarshal(bytesContent, &resp); err != nil {
-			log.Fatalln(err)
-		}
-		tablesStructure = slices.Concat(tablesStructure, resp.Reply)
-	}
-	return &tablesStructure
-}
-
-func getUsersData(host string, apiKey string) *[]User {
-	var resp DBResponse[User]
-	query := "select * from users"
-	bytesContent, err := callDbApi(host, apiKey, query)
-	if err != nil {
-		log.Fatalln(err)
-	}
-	if err := json.Unmarshal(bytesContent, &resp); err != nil {
-		log.Fatalln(err)
+	db := &database{host: host, apiKey: aiDevsApiKey}
+	runtime := &agent.Agent{
+		Model:             &openaiModel{client: openai.NewClient(option.WithAPIKey(openaiApiKey)), model: openai.ChatModelGPT4oMini},
+		Tools:             db.tools(),
+		MaxSteps:          *maxSteps,
+		TokenBudget:       *tokenBudget,
+		SubmitDescription: "Submit the IDs (dc_id) of the datacenters answering the question, call it once you know them.",
 	}
 
-	return &resp.Reply
-}
-
-func getDatacentersData(host string, apiKey string) *[]Datacenter {
-	var resp DBResponse[Datacenter]
-	query := "select * from datacenters"
-	bytesContent, err := callDbApi(host, apiKey, query)
+	question := "Which active datacenters (DC_ID) are managed by employees which are on leave (is_active=0)?"
+	var answer DatacentersAnswer
+	result, err := runtime.Run(ctx, []agent.Message{systemMessage(), {Role: agent.RoleUser, Content: question}}, &answer)
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatalf("no answer after %d steps and %d tokens: %v", result.Steps, result.Usage.Total(), err)
 	}
-	if err := json.Unmarshal(bytesContent, &resp); err != nil {
-		log.Fatalln(err)
-	}
-
-	return &resp.Reply
-}
+	log.Printf("answer after %d steps and %d tokens: %v", result.Steps, result.Usage.Total(), answer.DatacenterIDs)
 
-func getConnectionsData(host string, apiKey string) *[]Connection {
-	var resp DBResponse[Connection]
-	query := "select * from datacenters"
-	bytesContent, err := callDbApi(host, apiKey, query)
-	if err != nil {
-		log.Fatalln(err)
+	var ids []string
+	for _, id := range answer.DatacenterIDs {
+		ids = append(ids, strconv.Itoa(id))
 	}
-	if err := json.Unmarshal(bytesContent, &resp); err != nil {
-		log.Fatalln(err)
-	}
-
-	return &resp.Reply
+	sendResult(host, aiDevsApiKey, ids)
 }
 
 func callDbApi(host string, apiKey string, query string) ([]byte, error) {
@@ -194,22 +92,17 @@ func callDbApi(host string, apiKey string, query string) ([]byte, error) {
 	})
 	resp, err := client.Post(fmt.Sprintf("%s/apidb", host), "application/json", bytes.NewBuffer(payload))
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
-	defer func() {
-		if resp != nil {
-			resp.Body.Close()
-		}
-	}()
+	defer resp.Body.Close()
 
 	bytesBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		log.Println("ERROR: %s", string(bytesBody))
-		return nil, errors.New("Something went wrong while calling DB API")
+		return nil, fmt.Errorf("calling DB API failed | %d | %s", resp.StatusCode, string(bytesBody))
 	}
 	return bytesBody, nil
 }
@@ -249,41 +142,13 @@ func sendResult(host string, apikey string, finalAnswer []string) {
 	log.Printf(string(bytesBody))
 }
 
-func callModel(ctx context.Context, client *openai.Client, messages []openai.ChatCompletionMessageParamUnion) (string, error) {
-	resp, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages: openai.F(messages),
-		Model:    openai.F(openai.ChatModelGPT4oMini),
-	})
-	if err != nil {
-		log.Fatalf("Error while sending message: %v", err)
-		return "", err
-	}
-	answer := resp.Choices[0].Message.Content
-	return answer, nil
-}
-
-func prepareSystemMessage(tbStrutures string, users string, datacenters string, connections string) openai.ChatCompletionMessageParam {
-	return openai.ChatCompletionMessageParam{
-		Role: openai.F(openai.ChatCompletionMessageParamRole("system")),
-		Content: openai.F[interface{}]("" +
-			"You are powerful assistant which needs to help me to extract data from one database." +
-			"Database has tables: users, datacenters, connections. Tables structure is presented in the below jsons: \n" +
-			tbStrutures + "\n" +
-			"Table `users` contain following data: \n" + users + "\n" +
-			"Table `datacenters` contain following data: \n" + datacenters + "\n" +
-			"Table `connections` contain following data: \n" + connections + "\n" +
-			"Your goal is the help me further search the database to answers on different questions." +
-			"You can answer in two ways: " +
-			"1. If you need to do a query to the database to get more data you should send SQL query (everything in lowercase), then your answer should looks like: \"query: <sql_query>\". For example: query: select * from users where is_active=1" +
-			"2. If you know the answer on my question you need to response only in the format like: answer: <answer on my question>" +
-			"Next message will contain the my question.",
-		),
-	}
-}
-
-func prepareUserMessage(someData string) openai.ChatCompletionMessageParam {
-	return openai.ChatCompletionMessageParam{
-		Role:    openai.F(openai.ChatCompletionMessageParamRole("user")),
-		Content: openai.F[interface{}](someData),
+func systemMessage() agent.Message {
+	return agent.Message{
+		Role: agent.RoleSystem,
+		Content: "" +
+			"You are powerful assistant which needs to help me to extract data from one database. " +
+			"Use list_tables and describe_table to learn the structure of the database and run_sql to query it (MySQL, only select, show and desc queries). " +
+			"Check the structure before writing queries and correct the query when the tool returns an error. " +
+			"When you know the answer on my question call submit_answer.",
 	}
 }
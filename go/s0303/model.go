@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/openai/openai-go"
+	"shared/agent"
+)
+
+// openaiModel calls the OpenAI chat completions with the tools of the agent.
+type openaiModel struct {
+	client *openai.Client
+	model  openai.ChatModel
+}
+
+func (m *openaiModel) Complete(ctx context.Context, messages []agent.Message, tools []agent.ToolSpec) (agent.Message, agent.Usage, error) {
+	var params []openai.ChatCompletionMessageParamUnion
+	for _, message := range messages {
+		params = append(params, toParam(message))
+	}
+	var toolParams []openai.ChatCompletionToolParam
+	for _, tool := range tools {
+		toolParams = append(toolParams, openai.ChatCompletionToolParam{
+			Type: openai.F(openai.ChatCompletionToolTypeFunction),
+			Function: openai.F(openai.FunctionDefinitionParam{
+				Name:        openai.String(tool.Name),
+				Description: openai.String(tool.Description),
+				Parameters:  openai.F(openai.FunctionParameters(tool.Parameters)),
+			}),
+		})
+	}
+
+	resp, err := m.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Messages:          openai.F(params),
+		Model:             openai.F(m.model),
+		Tools:             openai.F(toolParams),
+		ParallelToolCalls: openai.F(false),
+	})
+	if err != nil {
+		return agent.Message{}, agent.Usage{}, err
+	}
+	usage := agent.Usage{PromptTokens: int(resp.Usage.PromptTokens), CompletionTokens: int(resp.Usage.CompletionTokens)}
+	if len(resp.Choices) == 0 {
+		return agent.Message{}, usage, fmt.Errorf("no choices in the response")
+	}
+	choice := resp.Choices[0].Message
+	reply := agent.Message{Role: agent.RoleAssistant, Content: choice.Content}
+	for _, call := range choice.ToolCalls {
+		reply.ToolCalls = append(reply.ToolCalls, agent.ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+	}
+	return reply, usage, nil
+}
+
+func toParam(message agent.Message) openai.ChatCompletionMessageParamUnion {
+	switch message.Role {
+	case agent.RoleSystem:
+		return openai.SystemMessage(message.Content)
+	case agent.RoleTool:
+		return openai.ToolMessage(message.ToolCallID, message.Content)
+	case agent.RoleAssistant:
+		param := openai.ChatCompletionAssistantMessageParam{Role: openai.F(openai.ChatCompletionAssistantMessageParamRoleAssistant)}
+		if message.Content != "" {
+			param.Content = openai.F([]openai.ChatCompletionAssistantMessageParamContentUnion{openai.TextPart(message.Content)})
+		}
+		if len(message.ToolCalls) > 0 {
+			var calls []openai.ChatCompletionMessageToolCallParam
+			for _, call := range message.ToolCalls {
+				calls = append(calls, openai.ChatCompletionMessageToolCallParam{
+					ID:   openai.F(call.ID),
+					Type: openai.F(openai.ChatCompletionMessageToolCallTypeFunction),
+					Function: openai.F(openai.ChatCompletionMessageToolCallFunctionParam{
+						Name:      openai.F(call.Name),
+						Arguments: openai.F(call.Arguments),
+					}),
+				})
+			}
+			param.ToolCalls = openai.F(calls)
+		}
+		return param
+	}
+	return openai.UserMessage(message.Content)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"shared/agent"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxToolOutput keeps a careless select * from using the whole token budget.
+const maxToolOutput = 20000
+
+type DatacentersAnswer struct {
+	DatacenterIDs []int `json:"datacenter_ids" desc:"IDs (dc_id) of the datacenters answering the question"`
+}
+
+// Validate rejects an empty answer, the question always has some datacenters.
+func (a *DatacentersAnswer) Validate() error {
+	if len(a.DatacenterIDs) == 0 {
+		return errors.New("datacenter_ids is empty, query the database for the datacenters")
+	}
+	return nil
+}
+
+type RunSQLArgs struct {
+	Query string `json:"query" desc:"MySQL query, only select, show, desc and explain queries are allowed"`
+}
+
+type DescribeTableArgs struct {
+	Table string `json:"table" desc:"name of the table"`
+}
+
+type ListTablesArgs struct{}
+
+// database runs the queries through the DB API of the task.
+type database struct {
+	host   string
+	apiKey string
+}
+
+func (d *database) tools() []agent.Tool {
+	return []agent.Tool{
+		agent.NewTool("list_tables", "List the tables of the database.", d.listTables),
+		agent.NewTool("describe_table", "Return the CREATE TABLE statement of the table.", d.describeTable),
+		agent.NewTool("run_sql", "Run a read only SQL query and return the rows as JSON.", d.runSQL),
+	}
+}
+
+// query runs the query and returns the rows of the reply.
+func (d *database) query(query string) (json.RawMessage, error) {
+	content, err := callDbApi(d.host, d.apiKey, query)
+	if err != nil {
+		return nil, err
+	}
+	var resp DBResponse[json.RawMessage]
+	if err := json.Unmarshal(content, &resp); err != nil {
+		return nil, fmt.Errorf("could not parse DB API response %s: %v", string(content), err)
+	}
+	if resp.Error != "" && resp.Error != "OK" {
+		return nil, fmt.Errorf("query failed: %s", resp.Error)
+	}
+	return json.Marshal(resp.Reply)
+}
+
+func (d *database) listTables(ctx context.Context, args ListTablesArgs) (string, error) {
+	rows, err := d.query("show tables")
+	if err != nil {
+		return "", err
+	}
+	var tables []TableInBanana
+	if err := json.Unmarshal(rows, &tables); err != nil {
+		return "", err
+	}
+	var names []string
+	for _, table := range tables {
+		names = append(names, table.Table)
+	}
+	return strings.Join(names, ", "), nil
+}
+
+func (d *database) describeTable(ctx context.Context, args DescribeTableArgs) (string, error) {
+	if strings.ContainsAny(args.Table, " `;'\"") {
+		return "", fmt.Errorf("invalid table name %q", args.Table)
+	}
+	rows, err := d.query("show create table " + args.Table)
+	if err != nil {
+		return "", err
+	}
+	var structures []TableStructure
+	if err := json.Unmarshal(rows, &structures); err != nil {
+		return "", err
+	}
+	if len(structures) == 0 {
+		return "", fmt.Errorf("table %s not found", args.Table)
+	}
+	return structures[0].CreateTable, nil
+}
+
+func (d *database) runSQL(ctx context.Context, args RunSQLArgs) (string, error) {
+	query := strings.TrimSpace(args.Query)
+	verb, _, _ := strings.Cut(strings.ToLower(query), " ")
+	switch verb {
+	case "select", "show", "desc", "describe", "explain":
+	default:
+		return "", fmt.Errorf("only select, show, desc and explain queries are allowed")
+	}
+	rows, err := d.query(query)
+	if err != nil {
+		return "", err
+	}
+	output := string(rows)
+	if len(output) > maxToolOutput {
+		cut := maxToolOutput
+		for cut > 0 && !utf8.RuneStart(output[cut]) {
+			cut--
+		}
+		output = output[:cut] + fmt.Sprintf("... (cut, %d bytes in total, narrow the query)", len(rows))
+	}
+	return output, nil
+}
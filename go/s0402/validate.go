@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/openai/openai-go"
@@ -12,6 +13,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"shared/batch"
+	"shared/review"
+	"strings"
 )
 
 const rootDir = "../../lab_data"
@@ -23,6 +27,10 @@ type FinalAnswer struct {
 }
 
 func main() {
+	reviewDir := flag.String("review", "review", "directory with answers waiting for human review and the reviewed decisions")
+	reviewAddr := flag.String("review-addr", "localhost:8080", "address of the review UI started when answers wait for review, empty to skip the review")
+	flag.Parse()
+
 	ctx := context.Background()
 	err := godotenv.Load("../../.env")
 
@@ -38,16 +46,61 @@ func main() {
 
 	content := ReadFile(fmt.Sprintf("%s/verify.txt", rootDir))
 
-	var correctData []string
+	reviewStore, err := review.Open(*reviewDir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	labels := make(map[string]string)
 	for _, c := range content {
 		id := c[0:2]
 		toValidate := c[3:]
+		hash := batch.ContentHash([]byte(toValidate))
+		if decision, ok := reviewStore.Decision(id, hash); ok {
+			labels[id] = decision.Label
+			continue
+		}
 		modelMessages := []openai.ChatCompletionMessageParamUnion{prepareUserMessage(toValidate)}
 		resp, err := callModel(ctx, openaiClient, modelMessages)
 		if err != nil {
 			log.Fatalln(err)
 		}
-		if resp == "Y" {
+		resp = strings.TrimSpace(resp)
+		if resp == "Y" || resp == "N" {
+			labels[id] = resp
+			continue
+		}
+		log.Printf("ambiguous answer %q for %s, queued for review", resp, id)
+		err = reviewStore.Add(review.Item{
+			ID:     id,
+			Text:   toValidate,
+			Hash:   hash,
+			Reason: fmt.Sprintf("the model answered %q, neither Y nor N", resp),
+			Labels: []string{"Y", "N"},
+		})
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if len(reviewStore.Pending()) > 0 && *reviewAddr != "" {
+		reviewStore.Serve(*reviewAddr)
+		log.Printf("waiting for human review at http://%s", *reviewAddr)
+		if err := reviewStore.WaitUntilReviewed(ctx); err != nil {
+			log.Fatalf("review not finished: %v", err)
+		}
+	}
+
+	var correctData []string
+	for _, c := range content {
+		id := c[0:2]
+		label, ok := labels[id]
+		if !ok {
+			if decision, reviewed := reviewStore.Decision(id, batch.ContentHash([]byte(c[3:]))); reviewed {
+				label = decision.Label
+			}
+		}
+		if label == "Y" {
 			correctData = append(correctData, id)
 		}
 	}
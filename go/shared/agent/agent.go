@@ -0,0 +1,197 @@
+// Package agent runs a language model in a loop calling tools until it
+// submits the final answer through the submit_answer tool. The provider
+// specific Model implementations live in the tasks.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+
+	SubmitTool = "submit_answer"
+)
+
+var (
+	ErrMaxSteps    = errors.New("agent: no answer within the step limit")
+	ErrTokenBudget = errors.New("agent: token budget exceeded")
+)
+
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Message is a message of the conversation. Assistant messages may carry tool
+// calls, tool messages answer the call with ToolCallID.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u Usage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// ToolSpec describes a tool to the model, Parameters is a JSON schema.
+type ToolSpec struct {
+	Name        string
+	Description string
+	Parameters  map[string]any
+}
+
+// Model sends the conversation with the tools to a language model and
+// returns its reply.
+type Model interface {
+	Complete(ctx context.Context, messages []Message, tools []ToolSpec) (Message, Usage, error)
+}
+
+type Tool struct {
+	ToolSpec
+	Run func(ctx context.Context, arguments string) (string, error)
+}
+
+// NewTool returns a tool whose arguments are decoded into A, the schema of the
+// parameters is derived from A (see Schema).
+func NewTool[A any](name string, description string, run func(ctx context.Context, args A) (string, error)) Tool {
+	var zero A
+	return Tool{
+		ToolSpec: ToolSpec{Name: name, Description: description, Parameters: Schema(zero)},
+		Run: func(ctx context.Context, arguments string) (string, error) {
+			var args A
+			if arguments != "" {
+				if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+					return "", fmt.Errorf("invalid arguments: %v", err)
+				}
+			}
+			return run(ctx, args)
+		},
+	}
+}
+
+// Agent gives the model at most MaxSteps replies and TokenBudget tokens (no
+// limit when zero) to submit the answer.
+type Agent struct {
+	Model       Model
+	Tools       []Tool
+	MaxSteps    int
+	TokenBudget int
+	// SubmitDescription tells the model what the answer is.
+	SubmitDescription string
+}
+
+type Result struct {
+	Steps    int       `json:"steps"`
+	Usage    Usage     `json:"usage"`
+	Messages []Message `json:"messages"`
+}
+
+// Validator is implemented by answers with rules beyond their schema, e.g. a
+// list which must not be empty.
+type Validator interface {
+	Validate() error
+}
+
+// Run continues the conversation until the model calls submit_answer, whose
+// arguments are decoded into answer (a pointer to a struct describing the
+// answer). The answer must have all the required fields and pass Validate when
+// it is a Validator. Tool errors and rejected answers are sent back to the
+// model so it can correct the call.
+func (a *Agent) Run(ctx context.Context, messages []Message, answer any) (*Result, error) {
+	tools := make(map[string]Tool)
+	var specs []ToolSpec
+	for _, tool := range a.Tools {
+		tools[tool.Name] = tool
+		specs = append(specs, tool.ToolSpec)
+	}
+	description := a.SubmitDescription
+	if description == "" {
+		description = "Submit the final answer, call it once you know it."
+	}
+	answerSchema := Schema(answer)
+	specs = append(specs, ToolSpec{Name: SubmitTool, Description: description, Parameters: answerSchema})
+
+	result := &Result{Messages: messages}
+	for result.Steps < a.MaxSteps {
+		result.Steps++
+		reply, usage, err := a.Model.Complete(ctx, result.Messages, specs)
+		if err != nil {
+			return result, fmt.Errorf("agent: step %d: %v", result.Steps, err)
+		}
+		result.Usage.PromptTokens += usage.PromptTokens
+		result.Usage.CompletionTokens += usage.CompletionTokens
+		reply.Role = RoleAssistant
+		result.Messages = append(result.Messages, reply)
+
+		if len(reply.ToolCalls) == 0 {
+			log.Printf("agent: step %d: %s", result.Steps, reply.Content)
+			result.Messages = append(result.Messages, Message{Role: RoleUser, Content: fmt.Sprintf("Answer only by calling the tools, call %s with the final answer.", SubmitTool)})
+		}
+
+		submitted := false
+		for _, call := range reply.ToolCalls {
+			log.Printf("agent: step %d: %s(%s)", result.Steps, call.Name, call.Arguments)
+			var content string
+			if call.Name == SubmitTool {
+				if err := decodeAnswer(call.Arguments, answerSchema, answer); err != nil {
+					content = fmt.Sprintf("error: invalid answer: %v", err)
+				} else {
+					content = "answer submitted"
+					submitted = true
+				}
+			} else if tool, ok := tools[call.Name]; !ok {
+				content = fmt.Sprintf("error: unknown tool %s", call.Name)
+			} else if output, err := tool.Run(ctx, call.Arguments); err != nil {
+				content = fmt.Sprintf("error: %v", err)
+			} else {
+				content = output
+			}
+			result.Messages = append(result.Messages, Message{Role: RoleTool, ToolCallID: call.ID, Content: content})
+		}
+		if submitted {
+			return result, nil
+		}
+		if a.TokenBudget > 0 && result.Usage.Total() >= a.TokenBudget {
+			return result, fmt.Errorf("%w: %d of %d tokens used", ErrTokenBudget, result.Usage.Total(), a.TokenBudget)
+		}
+	}
+	return result, ErrMaxSteps
+}
+
+// decodeAnswer decodes the arguments of submit_answer into answer, the
+// required fields of the schema must be present.
+func decodeAnswer(arguments string, schema map[string]any, answer any) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(arguments), &fields); err != nil {
+		return err
+	}
+	required, _ := schema["required"].([]string)
+	for _, name := range required {
+		if value, ok := fields[name]; !ok || string(value) == "null" {
+			return fmt.Errorf("missing required field %s", name)
+		}
+	}
+	if err := json.Unmarshal([]byte(arguments), answer); err != nil {
+		return err
+	}
+	if validator, ok := answer.(Validator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// scriptedModel replies with the scripted messages in turn and records the
+// conversations it was given.
+type scriptedModel struct {
+	replies []Message
+	usage   Usage
+	seen    [][]Message
+}
+
+func (m *scriptedModel) Complete(ctx context.Context, messages []Message, tools []ToolSpec) (Message, Usage, error) {
+	m.seen = append(m.seen, slices.Clone(messages))
+	if len(m.replies) == 0 {
+		return Message{Content: "thinking"}, m.usage, nil
+	}
+	reply := m.replies[0]
+	m.replies = m.replies[1:]
+	return reply, m.usage, nil
+}
+
+type echoArgs struct {
+	Text string `json:"text" desc:"text to echo"`
+}
+
+type answer struct {
+	IDs  []int  `json:"ids"`
+	Note string `json:"note,omitempty"`
+}
+
+func call(id string, name string, arguments string) Message {
+	return Message{ToolCalls: []ToolCall{{ID: id, Name: name, Arguments: arguments}}}
+}
+
+func echoTool() Tool {
+	return NewTool("echo", "Echo the text.", func(ctx context.Context, args echoArgs) (string, error) {
+		if args.Text == "" {
+			return "", errors.New("text is empty")
+		}
+		return args.Text, nil
+	})
+}
+
+// lastToolOutput returns the content of the tool message answering the call.
+func lastToolOutput(t *testing.T, messages []Message, id string) string {
+	t.Helper()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == RoleTool && messages[i].ToolCallID == id {
+			return messages[i].Content
+		}
+	}
+	t.Fatalf("no tool message for call %s", id)
+	return ""
+}
+
+func TestRunSubmitsAnswer(t *testing.T) {
+	model := &scriptedModel{replies: []Message{
+		call("1", "echo", `{"text":"hello"}`),
+		call("2", SubmitTool, `{"ids":[1,2]}`),
+	}, usage: Usage{PromptTokens: 10, CompletionTokens: 5}}
+	a := &Agent{Model: model, Tools: []Tool{echoTool()}, MaxSteps: 5}
+
+	var got answer
+	result, err := a.Run(context.Background(), []Message{{Role: RoleUser, Content: "question"}}, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got.IDs, []int{1, 2}) {
+		t.Errorf("answer = %v, want [1 2]", got.IDs)
+	}
+	if result.Steps != 2 || result.Usage.Total() != 30 {
+		t.Errorf("steps = %d, tokens = %d, want 2 and 30", result.Steps, result.Usage.Total())
+	}
+	if output := lastToolOutput(t, result.Messages, "1"); output != "hello" {
+		t.Errorf("echo output = %q", output)
+	}
+}
+
+func TestRunSendsErrorsBack(t *testing.T) {
+	model := &scriptedModel{replies: []Message{
+		call("1", "echo", `{"text":""}`),
+		call("2", "missing", `{}`),
+		call("3", "echo", `not json`),
+		call("4", SubmitTool, `{}`),
+		call("5", SubmitTool, `{"ids":null}`),
+		{Content: "the answer is 1"},
+		call("6", SubmitTool, `{"ids":[1]}`),
+	}}
+	a := &Agent{Model: model, Tools: []Tool{echoTool()}, MaxSteps: 10}
+
+	var got answer
+	result, err := a.Run(context.Background(), nil, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]string{
+		"1": "error: text is empty",
+		"2": "error: unknown tool missing",
+		"3": "error: invalid arguments",
+		"4": "error: invalid answer: missing required field ids",
+		"5": "error: invalid answer: missing required field ids",
+	} {
+		if output := lastToolOutput(t, result.Messages, id); !strings.HasPrefix(output, want) {
+			t.Errorf("output of call %s = %q, want %q", id, output, want)
+		}
+	}
+	// the text only reply is answered with a reminder to use the tools
+	nudge := model.seen[6][len(model.seen[6])-1]
+	if nudge.Role != RoleUser || !strings.Contains(nudge.Content, SubmitTool) {
+		t.Errorf("reply to a text answer = %+v", nudge)
+	}
+	if !slices.Equal(got.IDs, []int{1}) {
+		t.Errorf("answer = %v, want [1]", got.IDs)
+	}
+}
+
+type nonEmptyAnswer struct {
+	IDs []int `json:"ids"`
+}
+
+func (a *nonEmptyAnswer) Validate() error {
+	if len(a.IDs) == 0 {
+		return errors.New("ids is empty")
+	}
+	return nil
+}
+
+func TestRunValidatesAnswer(t *testing.T) {
+	model := &scriptedModel{replies: []Message{
+		call("1", SubmitTool, `{"ids":[]}`),
+		call("2", SubmitTool, `{"ids":[7]}`),
+	}}
+	a := &Agent{Model: model, MaxSteps: 3}
+
+	var got nonEmptyAnswer
+	result, err := a.Run(context.Background(), nil, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output := lastToolOutput(t, result.Messages, "1"); output != "error: invalid answer: ids is empty" {
+		t.Errorf("output of the empty answer = %q", output)
+	}
+	if result.Steps != 2 || !slices.Equal(got.IDs, []int{7}) {
+		t.Errorf("steps = %d, answer = %v", result.Steps, got.IDs)
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		agent     Agent
+		usage     Usage
+		wantErr   error
+		wantSteps int
+	}{
+		{"step limit", Agent{MaxSteps: 3}, Usage{}, ErrMaxSteps, 3},
+		{"token budget", Agent{MaxSteps: 10, TokenBudget: 250}, Usage{PromptTokens: 80, CompletionTokens: 20}, ErrTokenBudget, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			model := &scriptedModel{usage: test.usage}
+			a := test.agent
+			a.Model = model
+			a.Tools = []Tool{echoTool()}
+			var got answer
+			result, err := a.Run(context.Background(), nil, &got)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("err = %v, want %v", err, test.wantErr)
+			}
+			if result.Steps != test.wantSteps {
+				t.Errorf("steps = %d, want %d", result.Steps, test.wantSteps)
+			}
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema := Schema(&answer{})
+	if schema["type"] != "object" {
+		t.Fatalf("type = %v", schema["type"])
+	}
+	if required := schema["required"].([]string); !slices.Equal(required, []string{"ids"}) {
+		t.Errorf("required = %v, want [ids]", required)
+	}
+	ids := schema["properties"].(map[string]any)["ids"].(map[string]any)
+	if ids["type"] != "array" || ids["items"].(map[string]any)["type"] != "integer" {
+		t.Errorf("ids = %v", ids)
+	}
+	text := Schema(echoArgs{})["properties"].(map[string]any)["text"].(map[string]any)
+	if text["description"] != "text to echo" {
+		t.Errorf("text = %v", text)
+	}
+}
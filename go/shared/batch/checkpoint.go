@@ -0,0 +1,122 @@
+package batch
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type checkpointEntry struct {
+	Key     string          `json:"key"`
+	Hash    string          `json:"hash"`
+	Result  json.RawMessage `json:"result"`
+	SavedAt time.Time       `json:"saved_at"`
+}
+
+// Checkpoint is an append only JSON lines store of finished results keyed by
+// file path and content hash. The last entry of a key wins, so results of
+// changed files are simply appended again.
+type Checkpoint struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries map[string]checkpointEntry
+}
+
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint: could not open %s: %v", path, err)
+	}
+
+	entries := make(map[string]checkpointEntry)
+	reader := bufio.NewReader(file)
+	var offset int64
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			file.Close()
+			return nil, fmt.Errorf("checkpoint: could not read %s: %v", path, err)
+		}
+		if len(line) == 0 {
+			break
+		}
+		var entry checkpointEntry
+		jsonErr := json.Unmarshal(line, &entry)
+		if jsonErr != nil {
+			log.Printf("checkpoint: skipping broken line %d in %s: %v", lineNumber, path, jsonErr)
+		} else {
+			entries[entry.Key] = entry
+		}
+		if err == io.EOF {
+			// the last line is cut when the previous run crashed while
+			// writing it, the next entry must not be appended to it
+			if jsonErr == nil {
+				_, err = file.Write([]byte{'\n'})
+			} else {
+				err = file.Truncate(offset)
+			}
+			if err != nil {
+				file.Close()
+				return nil, fmt.Errorf("checkpoint: could not repair %s: %v", path, err)
+			}
+			break
+		}
+		offset += int64(len(line))
+	}
+	return &Checkpoint{file: file, entries: entries}, nil
+}
+
+// Lookup decodes the saved result into result when key was finished with the
+// same content. It returns false for unknown keys and changed content.
+func (c *Checkpoint) Lookup(key string, content []byte, result any) (bool, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok || entry.Hash != ContentHash(content) {
+		return false, nil
+	}
+	if err := json.Unmarshal(entry.Result, result); err != nil {
+		return false, fmt.Errorf("checkpoint: could not decode result of %s: %v", key, err)
+	}
+	return true, nil
+}
+
+// Save records the result of key and syncs it to disk before returning.
+func (c *Checkpoint) Save(key string, content []byte, result any) error {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("checkpoint: could not encode result of %s: %v", key, err)
+	}
+	entry := checkpointEntry{Key: key, Hash: ContentHash(content), Result: encoded, SavedAt: time.Now()}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("checkpoint: could not write %s: %v", key, err)
+	}
+	if err := c.file.Sync(); err != nil {
+		return fmt.Errorf("checkpoint: could not sync %s: %v", key, err)
+	}
+	c.entries[key] = entry
+	return nil
+}
+
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
+
+func ContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
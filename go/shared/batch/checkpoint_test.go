@@ -0,0 +1,104 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointRecoversFromCutLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	checkpoint, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkpoint.Save("a.txt", []byte("a"), []string{"first"}); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.Close()
+
+	// simulate a crash in the middle of writing the next entry
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"key":"b.txt","hash":"`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	checkpoint, err = OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkpoint.Save("b.txt", []byte("b"), []string{"second"}); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.Close()
+
+	checkpoint, err = OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkpoint.Close()
+	tests := []struct {
+		key     string
+		content string
+		want    string
+	}{
+		{"a.txt", "a", "first"},
+		{"b.txt", "b", "second"},
+	}
+	for _, test := range tests {
+		var result []string
+		found, err := checkpoint.Lookup(test.key, []byte(test.content), &result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found || len(result) != 1 || result[0] != test.want {
+			t.Errorf("Lookup(%s) = %v, %v, want [%s]", test.key, found, result, test.want)
+		}
+	}
+}
+
+func TestCheckpointKeepsCompleteLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	checkpoint, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkpoint.Save("a.txt", []byte("a"), "first"); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.Close()
+
+	// a hand edited file may miss the final new line
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content[:len(content)-1], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err = OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkpoint.Save("b.txt", []byte("b"), "second"); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.Close()
+
+	checkpoint, err = OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkpoint.Close()
+	for _, key := range []string{"a.txt", "b.txt"} {
+		var result string
+		if found, err := checkpoint.Lookup(key, []byte(key[:1]), &result); err != nil || !found {
+			t.Errorf("Lookup(%s) = %v, %v", key, found, err)
+		}
+	}
+}
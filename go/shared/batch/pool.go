@@ -0,0 +1,81 @@
+package batch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type Result[O any] struct {
+	Index int
+	Value O
+	Err   error
+}
+
+// Run processes items with at most workers goroutines. The returned results are
+// in the same order as items, an error of one item never stops the others.
+// When ctx is cancelled the items which were not started get ctx.Err().
+func Run[I any, O any](ctx context.Context, items []I, workers int, fn func(ctx context.Context, item I) (O, error)) []Result[O] {
+	if workers <= 0 {
+		workers = 1
+	}
+	results := make([]Result[O], len(items))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(items)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				value, err := fn(ctx, items[i])
+				results[i] = Result[O]{Index: i, Value: value, Err: err}
+			}
+		}()
+	}
+
+	next := 0
+feed:
+	for ; next < len(items); next++ {
+		select {
+		case <-ctx.Done():
+			break feed
+		case indexes <- next:
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i := next; i < len(items); i++ {
+		results[i] = Result[O]{Index: i, Err: ctx.Err()}
+	}
+	return results
+}
+
+// Limiter keeps a separate rate limit per provider (e.g. "gemini", "openai").
+// Providers without a configured limit are not throttled.
+type Limiter struct {
+	limiters map[string]*rate.Limiter
+}
+
+// NewLimiter creates limiters from requests per minute for every provider.
+func NewLimiter(requestsPerMinute map[string]int) *Limiter {
+	limiters := make(map[string]*rate.Limiter)
+	for provider, rpm := range requestsPerMinute {
+		if rpm > 0 {
+			limiters[provider] = rate.NewLimiter(rate.Every(time.Minute/time.Duration(rpm)), 1)
+		}
+	}
+	return &Limiter{limiters: limiters}
+}
+
+// Wait blocks until the provider allows the next request or ctx is done.
+func (l *Limiter) Wait(ctx context.Context, provider string) error {
+	limiter, ok := l.limiters[provider]
+	if !ok {
+		return ctx.Err()
+	}
+	return limiter.Wait(ctx)
+}
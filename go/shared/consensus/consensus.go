@@ -0,0 +1,149 @@
+package consensus
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Sample describes a single attempt. Samplers use Temperature and Index (e.g.
+// to shuffle the order of the inputs) to produce diverse answers.
+type Sample struct {
+	Index       int
+	Temperature float64
+}
+
+// Sampler produces one raw model answer for the given sample.
+type Sampler func(ctx context.Context, sample Sample) (string, error)
+
+type Options struct {
+	Samples       int
+	Temperatures  []float64
+	MinConfidence float64
+	// Extract returns the final entity from a raw answer, an empty string means
+	// that the answer does not contain any entity.
+	Extract func(answer string) string
+	// Escalate is called when there is no clear winner, usually with a stronger model.
+	Escalate Sampler
+}
+
+type Result struct {
+	Answer     string
+	Confidence float64
+	Votes      map[string]int
+	Answers    []string
+	Escalated  bool
+}
+
+var ErrNoAnswer = errors.New("consensus: no sample produced an answer")
+
+// Vote samples the answers, extracts the entity from each of them and returns
+// the majority. Confidence is the share of valid samples which voted for the
+// winner; when it is below MinConfidence or there is a tie the question is
+// escalated (if Escalate is set) and the escalated answer is returned.
+func Vote(ctx context.Context, sampler Sampler, opts Options) (*Result, error) {
+	if opts.Samples <= 0 {
+		opts.Samples = 1
+	}
+	if len(opts.Temperatures) == 0 {
+		opts.Temperatures = []float64{0}
+	}
+	if opts.Extract == nil {
+		opts.Extract = strings.TrimSpace
+	}
+
+	result := &Result{Votes: make(map[string]int)}
+	names := make(map[string]string)
+	valid := 0
+	var errs []error
+	for i := 0; i < opts.Samples; i++ {
+		answer, err := sampler(ctx, Sample{Index: i, Temperature: opts.Temperatures[i%len(opts.Temperatures)]})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sample %d: %w", i, err))
+			continue
+		}
+		result.Answers = append(result.Answers, answer)
+		entity := opts.Extract(answer)
+		key := Normalize(entity)
+		if key == "" {
+			continue
+		}
+		if _, ok := names[key]; !ok {
+			names[key] = strings.TrimSpace(entity)
+		}
+		result.Votes[key]++
+		valid++
+	}
+
+	ranking := make([]string, 0, len(result.Votes))
+	for key := range result.Votes {
+		ranking = append(ranking, key)
+	}
+	slices.SortFunc(ranking, func(a, b string) int {
+		if c := cmp.Compare(result.Votes[b], result.Votes[a]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+
+	tie := len(ranking) > 1 && result.Votes[ranking[0]] == result.Votes[ranking[1]]
+	if len(ranking) > 0 {
+		result.Answer = names[ranking[0]]
+		result.Confidence = float64(result.Votes[ranking[0]]) / float64(valid)
+	}
+	if len(ranking) > 0 && !tie && result.Confidence >= opts.MinConfidence {
+		return result, nil
+	}
+
+	if opts.Escalate == nil {
+		if len(ranking) == 0 {
+			return result, errors.Join(append([]error{ErrNoAnswer}, errs...)...)
+		}
+		return result, nil
+	}
+	answer, err := opts.Escalate(ctx, Sample{Index: opts.Samples})
+	if err != nil {
+		return result, fmt.Errorf("consensus: escalation failed: %w", err)
+	}
+	result.Answers = append(result.Answers, answer)
+	result.Escalated = true
+	if entity := strings.TrimSpace(opts.Extract(answer)); entity != "" {
+		result.Answer = entity
+		result.Confidence = float64(result.Votes[Normalize(entity)]+1) / float64(valid+1)
+	}
+	if result.Answer == "" {
+		return result, errors.Join(append([]error{ErrNoAnswer}, errs...)...)
+	}
+	return result, nil
+}
+
+// Normalize makes entities comparable: case, surrounding punctuation and
+// repeated white space are ignored.
+func Normalize(entity string) string {
+	entity = strings.TrimFunc(entity, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	})
+	return strings.ToLower(strings.Join(strings.Fields(entity), " "))
+}
+
+// LastLineAfter returns the text following the last occurrence of prefix (case
+// insensitive), or the last non empty line when the prefix is missing. It
+// suits answers like "... reasoning ... Answer: Grudziądz".
+func LastLineAfter(prefix string) func(string) string {
+	// the match is searched in the answer itself, lowercasing may change
+	// the byte offsets
+	re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(prefix))
+	return func(answer string) string {
+		if matches := re.FindAllStringIndex(answer, -1); len(matches) > 0 {
+			line, _, _ := strings.Cut(answer[matches[len(matches)-1][1]:], "\n")
+			return strings.TrimSpace(line)
+		}
+		lines := strings.Split(strings.TrimSpace(answer), "\n")
+		return strings.TrimSpace(lines[len(lines)-1])
+	}
+}
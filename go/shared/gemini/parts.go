@@ -0,0 +1,28 @@
+// Package gemini converts the provider neutral content of the shared packages
+// to the parts of the Gemini SDK.
+package gemini
+
+import (
+	"github.com/google/generative-ai-go/genai"
+	"log"
+	"shared/ingest"
+	"shared/media"
+)
+
+// Parts converts the parts extracted from the file called name, images are
+// logged with their estimated token cost.
+func Parts(name string, parts []ingest.Part) []genai.Part {
+	var converted []genai.Part
+	for _, part := range parts {
+		switch part.Kind {
+		case ingest.KindText:
+			converted = append(converted, genai.Text(part.Text))
+		case ingest.KindImage:
+			log.Printf("image %s sent as %s, estimated %d tokens", name, part.MIME, media.GeminiLimits.EstimateTokens(part.Width, part.Height))
+			converted = append(converted, genai.ImageData(media.Format(part.MIME), part.Data))
+		case ingest.KindAudio:
+			converted = append(converted, genai.Blob{MIMEType: part.MIME, Data: part.Data})
+		}
+	}
+	return converted
+}
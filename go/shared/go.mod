@@ -0,0 +1,9 @@
+module shared
+
+go 1.23.2
+
+require (
+	golang.org/x/image v0.25.0
+	golang.org/x/net v0.34.0
+	golang.org/x/time v0.9.0
+)
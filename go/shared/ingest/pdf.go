@@ -0,0 +1,130 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var pdfStreamRegexp = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+
+// PDFToText extracts text shown by the Tj, TJ, ' and " operators of the page
+// content streams. It handles uncompressed and FlateDecode streams with
+// literal strings, which covers PDFs exported from text editors; scanned
+// documents need OCR instead.
+func PDFToText(data []byte) (string, error) {
+	var b strings.Builder
+	for _, match := range pdfStreamRegexp.FindAllSubmatchIndex(data, -1) {
+		dict := data[match[2]:match[3]]
+		start := match[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			continue
+		}
+		stream := data[start : start+end]
+
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			reader, err := zlib.NewReader(bytes.NewReader(stream))
+			if err != nil {
+				continue
+			}
+			stream, err = io.ReadAll(reader)
+			if err != nil && len(stream) == 0 {
+				continue
+			}
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			// other filters (images, fonts) do not carry page text
+			continue
+		}
+		extractPDFText(stream, &b)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+func extractPDFText(content []byte, b *strings.Builder) {
+	var pending []string
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; {
+		case c == '(':
+			text, next := readPDFString(content, i+1)
+			pending = append(pending, text)
+			i = next
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case isPDFOperatorStart(c):
+			j := i
+			for j < len(content) && isPDFOperatorChar(content[j]) {
+				j++
+			}
+			switch string(content[i:j]) {
+			case "Tj", "TJ":
+				b.WriteString(strings.Join(pending, ""))
+			case "'", "\"":
+				b.WriteString("\n" + strings.Join(pending, ""))
+			case "Td", "TD", "T*", "ET":
+				if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+					b.WriteString("\n")
+				}
+			}
+			pending = pending[:0]
+			i = j - 1
+		}
+	}
+}
+
+// readPDFString reads a literal string starting after the opening bracket and
+// returns the decoded text and the index of the closing bracket.
+func readPDFString(content []byte, i int) (string, int) {
+	var s strings.Builder
+	depth := 1
+	for ; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\\' && i+1 < len(content):
+			i++
+			switch e := content[i]; e {
+			case 'n':
+				s.WriteByte('\n')
+			case 'r', 't', 'b', 'f':
+				s.WriteByte(' ')
+			case '\r', '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					code := 0
+					for k := 0; k < 3 && i < len(content) && content[i] >= '0' && content[i] <= '7'; k++ {
+						code = code*8 + int(content[i]-'0')
+						i++
+					}
+					i--
+					s.WriteRune(rune(code))
+				} else {
+					s.WriteByte(e)
+				}
+			}
+		case c == '(':
+			depth++
+			s.WriteByte(c)
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return s.String(), i
+			}
+			s.WriteByte(c)
+		default:
+			s.WriteRune(rune(c))
+		}
+	}
+	return s.String(), i
+}
+
+func isPDFOperatorStart(c byte) bool {
+	return c == '\'' || c == '"' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+func isPDFOperatorChar(c byte) bool {
+	return c == '*' || isPDFOperatorStart(c)
+}
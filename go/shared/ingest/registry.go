@@ -0,0 +1,116 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"shared/media"
+	"strings"
+	"unicode/utf8"
+)
+
+type Kind string
+
+const (
+	KindText  Kind = "text"
+	KindImage Kind = "image"
+	KindAudio Kind = "audio"
+)
+
+// Part is a provider neutral piece of content, tasks convert it to the parts of
+// their model SDK (genai.Part, openai content parts...).
+type Part struct {
+	Kind   Kind
+	Text   string
+	MIME   string
+	Data   []byte
+	Width  int
+	Height int
+}
+
+// Handler turns the file content into content parts.
+type Handler func(name string, data []byte) ([]Part, error)
+
+var ErrUnsupported = errors.New("ingest: unsupported file type")
+
+type Registry struct {
+	handlers map[string]Handler
+}
+
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[string]Handler)}
+}
+
+// NewDefaultRegistry knows text, HTML, PDF, PNG/JPEG (and other images which
+// are converted to fit the limits) and MP3/WAV/OGG audio.
+func NewDefaultRegistry(limits media.Limits) *Registry {
+	r := NewRegistry()
+	r.Register(media.MIMEText, TextHandler)
+	r.Register(media.MIMEHTML, HTMLHandler)
+	r.Register(media.MIMEPDF, PDFHandler)
+	for _, mime := range []string{media.MIMEPNG, media.MIMEJPEG, media.MIMEGIF, media.MIMEWebP, media.MIMEBMP, media.MIMETIFF} {
+		r.Register(mime, ImageHandler(limits))
+	}
+	for _, mime := range []string{media.MIMEMP3, media.MIMEWAV, media.MIMEOGG} {
+		r.Register(mime, AudioHandler)
+	}
+	return r
+}
+
+// Register adds or replaces the handler of the MIME type.
+func (r *Registry) Register(mime string, handler Handler) {
+	r.handlers[mime] = handler
+}
+
+// Parts detects the type of data and calls the registered handler.
+func (r *Registry) Parts(name string, data []byte) ([]Part, error) {
+	mime := media.Detect(data)
+	handler, ok := r.handlers[mime]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s (%s)", ErrUnsupported, name, mime)
+	}
+	parts, err := handler(name, data)
+	if err != nil {
+		return nil, fmt.Errorf("ingest: %s: %v", name, err)
+	}
+	return parts, nil
+}
+
+func TextHandler(name string, data []byte) ([]Part, error) {
+	if !utf8.Valid(data) {
+		return nil, errors.New("text is not valid UTF-8")
+	}
+	return []Part{{Kind: KindText, MIME: media.MIMEText, Text: string(data)}}, nil
+}
+
+func ImageHandler(limits media.Limits) Handler {
+	return func(name string, data []byte) ([]Part, error) {
+		img, err := media.PrepareImage(data, limits)
+		if err != nil {
+			return nil, err
+		}
+		return []Part{{Kind: KindImage, MIME: img.MIME, Data: img.Data, Width: img.Width, Height: img.Height}}, nil
+	}
+}
+
+func AudioHandler(name string, data []byte) ([]Part, error) {
+	return []Part{{Kind: KindAudio, MIME: media.Detect(data), Data: data}}, nil
+}
+
+func HTMLHandler(name string, data []byte) ([]Part, error) {
+	text, err := HTMLToText(data)
+	if err != nil {
+		return nil, err
+	}
+	return []Part{{Kind: KindText, MIME: media.MIMEText, Text: text}}, nil
+}
+
+func PDFHandler(name string, data []byte) ([]Part, error) {
+	text, err := PDFToText(data)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, errors.New("no text found in PDF")
+	}
+	return []Part{{Kind: KindText, MIME: media.MIMEText, Text: text}}, nil
+}
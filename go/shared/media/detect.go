@@ -0,0 +1,67 @@
+package media
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+const (
+	MIMEPNG  = "image/png"
+	MIMEJPEG = "image/jpeg"
+	MIMEGIF  = "image/gif"
+	MIMEWebP = "image/webp"
+	MIMEBMP  = "image/bmp"
+	MIMETIFF = "image/tiff"
+	MIMEMP3  = "audio/mpeg"
+	MIMEWAV  = "audio/wav"
+	MIMEOGG  = "audio/ogg"
+	MIMEPDF  = "application/pdf"
+	MIMEHTML = "text/html"
+	MIMEText = "text/plain"
+)
+
+// Detect returns the MIME type of data based on its magic bytes, the file name
+// or extension is never taken into account.
+func Detect(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return MIMEPNG
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return MIMEJPEG
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return MIMEGIF
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return MIMEWebP
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE")):
+		return MIMEWAV
+	case bytes.HasPrefix(data, []byte("BM")) && len(data) > 14:
+		return MIMEBMP
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return MIMETIFF
+	case bytes.HasPrefix(data, []byte("ID3")), len(data) > 1 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		return MIMEMP3
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return MIMEOGG
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return MIMEPDF
+	}
+
+	detected, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	return detected
+}
+
+func IsImage(mime string) bool {
+	return strings.HasPrefix(mime, "image/")
+}
+
+func IsAudio(mime string) bool {
+	return strings.HasPrefix(mime, "audio/")
+}
+
+// Format returns the subtype of the MIME type, e.g. "png" for "image/png".
+// It is the format expected by genai.ImageData.
+func Format(mime string) string {
+	_, subtype, _ := strings.Cut(mime, "/")
+	return subtype
+}
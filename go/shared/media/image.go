@@ -0,0 +1,186 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"slices"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	ProviderOpenAI = "openai"
+	ProviderGemini = "gemini"
+)
+
+// Limits describes what a vision provider accepts. MaxSide of 0 means the
+// image is never downscaled.
+type Limits struct {
+	Provider      string
+	MaxSide       int
+	Formats       []string
+	StripMetadata bool
+}
+
+var OpenAILimits = Limits{
+	Provider:      ProviderOpenAI,
+	MaxSide:       2048,
+	Formats:       []string{MIMEPNG, MIMEJPEG, MIMEGIF, MIMEWebP},
+	StripMetadata: true,
+}
+
+var GeminiLimits = Limits{
+	Provider:      ProviderGemini,
+	MaxSide:       3072,
+	Formats:       []string{MIMEPNG, MIMEJPEG, MIMEWebP},
+	StripMetadata: true,
+}
+
+type Image struct {
+	MIME   string
+	Data   []byte
+	Width  int
+	Height int
+}
+
+// PrepareImage detects the real type of data and returns an image which fits
+// the limits. The image is re-encoded only when it is too big, its format is
+// not supported by the provider or it carries EXIF metadata which should be
+// stripped; JPEG stays JPEG, every other format is converted to PNG.
+func PrepareImage(data []byte, limits Limits) (*Image, error) {
+	mime := Detect(data)
+	if !IsImage(mime) {
+		return nil, fmt.Errorf("media: expected image, got %s", mime)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("media: could not read %s header: %v", mime, err)
+	}
+
+	tooBig := limits.MaxSide > 0 && max(config.Width, config.Height) > limits.MaxSide
+	unsupported := !slices.Contains(limits.Formats, mime)
+	withMetadata := limits.StripMetadata && mime == MIMEJPEG && hasEXIF(data)
+	if !tooBig && !unsupported && !withMetadata {
+		return &Image{MIME: mime, Data: data, Width: config.Width, Height: config.Height}, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("media: could not decode %s: %v", mime, err)
+	}
+	if tooBig {
+		img = downscale(img, limits.MaxSide)
+	}
+
+	outMIME := MIMEPNG
+	if mime == MIMEJPEG {
+		outMIME = MIMEJPEG
+	}
+	return encode(img, outMIME)
+}
+
+// Tile splits the image into tiles of at most size x size pixels, left to right
+// and top to bottom. Small images are returned as a single tile.
+func Tile(img *Image, size int) ([]*Image, error) {
+	if size <= 0 || (img.Width <= size && img.Height <= size) {
+		return []*Image{img}, nil
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, fmt.Errorf("media: could not decode %s: %v", img.MIME, err)
+	}
+	bounds := decoded.Bounds()
+
+	var tiles []*Image
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += size {
+		for x := bounds.Min.X; x < bounds.Max.X; x += size {
+			rect := image.Rect(x, y, min(x+size, bounds.Max.X), min(y+size, bounds.Max.Y))
+			tile := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+			draw.Draw(tile, tile.Bounds(), decoded, rect.Min, draw.Src)
+			encoded, err := encode(tile, img.MIME)
+			if err != nil {
+				return nil, err
+			}
+			tiles = append(tiles, encoded)
+		}
+	}
+	return tiles, nil
+}
+
+// EstimateTokens returns the approximate number of input tokens the provider
+// charges for an image of the given size.
+func (l Limits) EstimateTokens(width int, height int) int {
+	switch l.Provider {
+	case ProviderOpenAI:
+		// high detail: fit into 2048x2048, shortest side down to 768, 170 tokens per 512px tile
+		w, h := float64(width), float64(height)
+		if scale := 2048 / max(w, h); scale < 1 {
+			w, h = w*scale, h*scale
+		}
+		if scale := 768 / min(w, h); scale < 1 {
+			w, h = w*scale, h*scale
+		}
+		tiles := math.Ceil(w/512) * math.Ceil(h/512)
+		return 85 + 170*int(tiles)
+	case ProviderGemini:
+		// 258 tokens for small images, larger ones are tiled into 768x768 crops
+		if width <= 384 && height <= 384 {
+			return 258
+		}
+		tiles := math.Ceil(float64(width)/768) * math.Ceil(float64(height)/768)
+		return 258 * int(tiles)
+	default:
+		return 0
+	}
+}
+
+func downscale(img image.Image, maxSide int) image.Image {
+	bounds := img.Bounds()
+	scale := float64(maxSide) / float64(max(bounds.Dx(), bounds.Dy()))
+	width := max(1, int(math.Round(float64(bounds.Dx())*scale)))
+	height := max(1, int(math.Round(float64(bounds.Dy())*scale)))
+
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Over, nil)
+	return resized
+}
+
+func encode(img image.Image, mime string) (*Image, error) {
+	var buf bytes.Buffer
+	var err error
+	if mime == MIMEJPEG {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	} else {
+		mime = MIMEPNG
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("media: could not encode %s: %v", mime, err)
+	}
+	bounds := img.Bounds()
+	return &Image{MIME: mime, Data: buf.Bytes(), Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+// hasEXIF looks for the APP1 Exif segment in JPEG headers.
+func hasEXIF(data []byte) bool {
+	for i := 2; i+10 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xDA {
+			return false
+		}
+		length := int(data[i+2])<<8 | int(data[i+3])
+		if marker == 0xE1 && bytes.HasPrefix(data[i+4:], []byte("Exif\x00")) {
+			return true
+		}
+		i += 2 + length
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package polish
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// months are the nominative and genitive forms of the month names.
+var months = map[string]int{
+	"styczeń": 1, "stycznia": 1, "luty": 2, "lutego": 2, "marzec": 3, "marca": 3,
+	"kwiecień": 4, "kwietnia": 4, "maj": 5, "maja": 5, "czerwiec": 6, "czerwca": 6,
+	"lipiec": 7, "lipca": 7, "sierpień": 8, "sierpnia": 8, "wrzesień": 9, "września": 9,
+	"październik": 10, "października": 10, "listopad": 11, "listopada": 11, "grudzień": 12, "grudnia": 12,
+}
+
+var (
+	// the dates are not bounded by \b, which treats _ as a part of a word and
+	// misses names like report_2024_01_08.txt, FindDates checks instead that
+	// they are not parts of longer numbers
+	isoDateRegexp     = regexp.MustCompile(`(\d{4})[-_./](\d{1,2})[-_./](\d{1,2})`)
+	numericDateRegexp = regexp.MustCompile(`(\d{1,2})[./-](\d{1,2})[./-](\d{4})`)
+	textDateRegexp    = regexp.MustCompile(`(?i)(\d{1,2})\s+(\pL+)\s+(\d{4})`)
+)
+
+// Date is a date found in a text, Value is formatted as YYYY-MM-DD.
+type Date struct {
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+// FindDates returns the dates written as 2024-01-08, 2024_01_08, 8.01.2024 or
+// "8 stycznia 2024" in the order they appear, invalid dates are skipped.
+func FindDates(text string) []Date {
+	type found struct {
+		start int
+		date  Date
+	}
+	var all []found
+	add := func(pattern *regexp.Regexp, parse func(groups []string) (int, int, int, bool)) {
+		for _, match := range pattern.FindAllStringSubmatchIndex(text, -1) {
+			if isDigitAt(text, match[0]-1) || isDigitAt(text, match[1]) {
+				continue
+			}
+			groups := make([]string, len(match)/2)
+			for i := range groups {
+				groups[i] = text[match[2*i]:match[2*i+1]]
+			}
+			year, month, day, ok := parse(groups)
+			if !ok {
+				continue
+			}
+			value, ok := formatDate(year, month, day)
+			if !ok {
+				continue
+			}
+			all = append(all, found{start: match[0], date: Date{Text: groups[0], Value: value}})
+		}
+	}
+	add(isoDateRegexp, func(g []string) (int, int, int, bool) {
+		return atoi(g[1]), atoi(g[2]), atoi(g[3]), true
+	})
+	add(numericDateRegexp, func(g []string) (int, int, int, bool) {
+		return atoi(g[3]), atoi(g[2]), atoi(g[1]), true
+	})
+	add(textDateRegexp, func(g []string) (int, int, int, bool) {
+		month := MonthNumber(g[2])
+		return atoi(g[3]), month, atoi(g[1]), month > 0
+	})
+
+	slices.SortStableFunc(all, func(a, b found) int { return cmp.Compare(a.start, b.start) })
+	var dates []Date
+	for _, f := range all {
+		dates = append(dates, f.date)
+	}
+	return dates
+}
+
+// MonthNumber returns the number of the Polish month name in the nominative
+// or genitive case, or 0.
+func MonthNumber(name string) int {
+	return months[strings.ToLower(name)]
+}
+
+func formatDate(year int, month int, day int) (string, bool) {
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Year() != year || int(date.Month()) != month || date.Day() != day {
+		return "", false
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", year, month, day), true
+}
+
+func isDigitAt(text string, i int) bool {
+	return i >= 0 && i < len(text) && text[i] >= '0' && text[i] <= '9'
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,40 @@
+package polish
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFindDates(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"2024-01-08_report-00-sektor_C4.txt", []string{"2024-01-08"}},
+		{"report_2024_01_08.txt", []string{"2024-01-08"}},
+		{"Spotkanie 8.01.2024, potem 2024/02/29.", []string{"2024-01-08", "2024-02-29"}},
+		{"W dniu 8 stycznia 2024 oraz 12 Marca 2023", []string{"2024-01-08", "2023-03-12"}},
+		{"2024-01-08 2024-01-09", []string{"2024-01-08", "2024-01-09"}},
+		// invalid dates and parts of longer numbers
+		{"2023-02-29 31.04.2024", nil},
+		{"numer 12024-01-08 i 2024-01-0812", nil},
+		{"Marek 5 razy 2024", nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, date := range FindDates(test.text) {
+			got = append(got, date.Value)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("FindDates(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestMonthNumber(t *testing.T) {
+	for name, want := range map[string]int{"stycznia": 1, "Październik": 10, "grudnia": 12, "marek": 0} {
+		if got := MonthNumber(name); got != want {
+			t.Errorf("MonthNumber(%q) = %d, want %d", name, got, want)
+		}
+	}
+}
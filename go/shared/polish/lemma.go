@@ -0,0 +1,137 @@
+package polish
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// dictionary is a small PoliMorf style dictionary (form, lemma, tags separated
+// by tabs) with the vocabulary of the tasks. The full PoliMorf file can be
+// loaded on top of it with LoadDictionary.
+//
+//go:embed dictionary.tsv
+var dictionary string
+
+// Lemmatizer maps inflected Polish forms to their nominative (dictionary) form.
+// Single words and multi word phrases are looked up as a whole.
+type Lemmatizer struct {
+	mu      sync.RWMutex
+	forms   map[string]string
+	lemmas  map[string]bool
+	plurals map[string]bool
+}
+
+func NewLemmatizer() *Lemmatizer {
+	l := &Lemmatizer{forms: make(map[string]string), lemmas: make(map[string]bool), plurals: make(map[string]bool)}
+	if err := l.Read(strings.NewReader(dictionary)); err != nil {
+		panic(fmt.Sprintf("polish: broken bundled dictionary: %v", err))
+	}
+	return l
+}
+
+// LoadDictionary adds the entries of a PoliMorf file, a missing file is not an error.
+func (l *Lemmatizer) LoadDictionary(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := l.Read(file); err != nil {
+		return fmt.Errorf("polish: could not read dictionary %s: %v", path, err)
+	}
+	return nil
+}
+
+// Read adds the entries of r, lines starting with # are comments. The first
+// lemma of an ambiguous form wins. Nominative plural forms are kept as they
+// are, unless the form has another analysis, e.g. nauczycielki is also the
+// genitive singular of nauczycielka.
+func (l *Lemmatizer) Read(r io.Reader) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			return fmt.Errorf("invalid line %q", line)
+		}
+		form, lemma := Normalize(fields[0]), Normalize(fields[1])
+		l.lemmas[lemma] = true
+		if len(fields) > 2 && isNominative(fields[2]) {
+			if form != lemma {
+				l.plurals[form] = true
+			}
+			continue
+		}
+		if _, ok := l.forms[form]; !ok {
+			l.forms[form] = lemma
+		}
+	}
+	return scanner.Err()
+}
+
+// Learn adds a form found elsewhere, e.g. returned by a language model.
+func (l *Lemmatizer) Learn(form string, lemma string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	form, lemma = Normalize(form), Normalize(lemma)
+	l.forms[form] = lemma
+	l.lemmas[lemma] = true
+}
+
+// Lemma returns the nominative form of the word or phrase, ok is false when
+// it is not known.
+func (l *Lemmatizer) Lemma(phrase string) (string, bool) {
+	phrase = Normalize(phrase)
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.lemmas[phrase] {
+		return phrase, true
+	}
+	if lemma, ok := l.forms[phrase]; ok {
+		return lemma, true
+	}
+	if l.plurals[phrase] {
+		return phrase, true
+	}
+	return "", false
+}
+
+// isNominative reports whether the PoliMorf tags, e.g. subst:pl:acc.nom.voc:f,
+// include the nominative case.
+func isNominative(tags string) bool {
+	for _, tag := range strings.FieldsFunc(tags, func(r rune) bool { return r == ':' || r == '.' || r == '+' }) {
+		if tag == "nom" {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize lowercases the text and replaces everything but letters and
+// digits with single spaces.
+func Normalize(text string) string {
+	return strings.Join(Tokenize(text), " ")
+}
+
+// Tokenize splits the text to lowercase words of letters (with the Polish
+// diacritics) and digits.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
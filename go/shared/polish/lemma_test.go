@@ -0,0 +1,52 @@
+package polish
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLemma(t *testing.T) {
+	lemmatizer := NewLemmatizer()
+	tests := []struct {
+		phrase string
+		want   string
+		ok     bool
+	}{
+		{"nauczyciel", "nauczyciel", true},
+		{"Nauczyciela", "nauczyciel", true},
+		{"nauczycielce", "nauczycielka", true},
+		// genitive singular and nominative plural, the singular wins
+		{"nauczycielki", "nauczycielka", true},
+		// only a nominative plural, kept as it is
+		{"nauczyciele", "nauczyciele", true},
+		{"nieznane", "", false},
+	}
+	for _, test := range tests {
+		lemma, ok := lemmatizer.Lemma(test.phrase)
+		if ok != test.ok || (ok && lemma != test.want) {
+			t.Errorf("Lemma(%q) = %q, %v, want %q, %v", test.phrase, lemma, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestLemmaPoliMorfTags(t *testing.T) {
+	lemmatizer := NewLemmatizer()
+	dictionary := "programistki\tprogramistka\tsubst:sg:gen:f\n" +
+		"programistki\tprogramistka\tsubst:pl:acc.nom.voc:f\n" +
+		"programiści\tprogramista\tsubst:pl:nom.voc:m1\n"
+	if err := lemmatizer.Read(strings.NewReader(dictionary)); err != nil {
+		t.Fatal(err)
+	}
+	for phrase, want := range map[string]string{"programistki": "programistka", "programiści": "programiści"} {
+		if lemma, ok := lemmatizer.Lemma(phrase); !ok || lemma != want {
+			t.Errorf("Lemma(%q) = %q, %v, want %q", phrase, lemma, ok, want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := strings.Join(Tokenize("Zgłoszenie nr 12: Łódź, ul. Żółta-5!"), "|")
+	if want := "zgłoszenie|nr|12|łódź|ul|żółta|5"; got != want {
+		t.Errorf("Tokenize = %s, want %s", got, want)
+	}
+}
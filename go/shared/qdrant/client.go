@@ -0,0 +1,115 @@
+package qdrant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls the REST API of a Qdrant server.
+type Client struct {
+	BaseURL string
+	APIKey  string
+	HTTP    *http.Client
+}
+
+func NewClient(baseURL string, apiKey string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), APIKey: apiKey, HTTP: http.DefaultClient}
+}
+
+// response is the envelope of every Qdrant answer.
+type response struct {
+	Result json.RawMessage `json:"result"`
+	Status any             `json:"status"`
+}
+
+func (c *Client) CreateCollection(ctx context.Context, name string, params VectorParams) error {
+	status, result, err := c.do(ctx, http.MethodGet, "/collections/"+url.PathEscape(name), nil)
+	if err != nil && status != http.StatusNotFound {
+		return err
+	}
+	if status == http.StatusOK {
+		var info struct {
+			Config struct {
+				Params struct {
+					Vectors VectorParams `json:"vectors"`
+				} `json:"params"`
+			} `json:"config"`
+		}
+		if err := json.Unmarshal(result, &info); err != nil {
+			return fmt.Errorf("qdrant: could not parse collection %s: %v", name, err)
+		}
+		return checkParams(name, info.Config.Params.Vectors, params)
+	}
+	_, _, err = c.do(ctx, http.MethodPut, "/collections/"+url.PathEscape(name), map[string]any{"vectors": params})
+	return err
+}
+
+func (c *Client) DeleteCollection(ctx context.Context, name string) error {
+	status, _, err := c.do(ctx, http.MethodDelete, "/collections/"+url.PathEscape(name), nil)
+	if status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) Upsert(ctx context.Context, collection string, points []Point) error {
+	_, _, err := c.do(ctx, http.MethodPut, "/collections/"+url.PathEscape(collection)+"/points?wait=true", map[string]any{"points": points})
+	return err
+}
+
+func (c *Client) Search(ctx context.Context, collection string, req SearchRequest) ([]ScoredPoint, error) {
+	_, result, err := c.do(ctx, http.MethodPost, "/collections/"+url.PathEscape(collection)+"/points/search", req)
+	if err != nil {
+		return nil, err
+	}
+	var points []ScoredPoint
+	if err := json.Unmarshal(result, &points); err != nil {
+		return nil, fmt.Errorf("qdrant: could not parse search result: %v", err)
+	}
+	return points, nil
+}
+
+// do sends the request and returns the status code and the result field of
+// the answer.
+func (c *Client) do(ctx context.Context, method string, path string, body any) (int, json.RawMessage, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("api-key", c.APIKey)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil, fmt.Errorf("qdrant: %s %s failed | %d | %s", method, path, resp.StatusCode, string(respBody))
+	}
+	var envelope response
+	if err := json.Unmarshal(respBody, &envelope); err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("qdrant: could not parse answer of %s %s: %v", method, path, err)
+	}
+	return resp.StatusCode, envelope.Result, nil
+}
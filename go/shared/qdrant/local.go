@@ -0,0 +1,305 @@
+package qdrant
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"shared/retrieval"
+	"slices"
+	"sync"
+)
+
+type collection struct {
+	Params VectorParams `json:"params"`
+	Points []Point      `json:"points"`
+}
+
+// Local is the embedded store, every collection is searched by comparing the
+// vector with all its points. With dir set the collections are saved as
+// dir/<name>.json after every change.
+type Local struct {
+	dir         string
+	mu          sync.RWMutex
+	collections map[string]*collection
+}
+
+// OpenLocal loads the collections saved in dir, an empty dir keeps them in
+// memory only.
+func OpenLocal(dir string) (*Local, error) {
+	l := &Local{dir: dir, collections: make(map[string]*collection)}
+	if dir == "" {
+		return l, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var c collection
+		if err := json.Unmarshal(content, &c); err != nil {
+			return nil, fmt.Errorf("qdrant: could not parse collection %s: %v", file, err)
+		}
+		name := filepath.Base(file)
+		l.collections[name[:len(name)-len(".json")]] = &c
+	}
+	return l, nil
+}
+
+func (l *Local) CreateCollection(ctx context.Context, name string, params VectorParams) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.collections[name]; ok {
+		return checkParams(name, c.Params, params)
+	}
+	if params.Distance != DistanceCosine {
+		return fmt.Errorf("qdrant: the embedded store supports only the %s distance", DistanceCosine)
+	}
+	l.collections[name] = &collection{Params: params}
+	return l.save(name)
+}
+
+func (l *Local) DeleteCollection(ctx context.Context, name string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.collections, name)
+	if l.dir == "" {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(l.dir, name+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Upsert(ctx context.Context, name string, points []Point) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.collections[name]
+	if !ok {
+		return fmt.Errorf("qdrant: collection %s does not exist", name)
+	}
+	for _, point := range points {
+		if len(point.Vector) != c.Params.Size {
+			return fmt.Errorf("qdrant: point %s has %d dimensions, collection %s expects %d", point.ID, len(point.Vector), name, c.Params.Size)
+		}
+		payload, err := normalizePayload(point.Payload)
+		if err != nil {
+			return err
+		}
+		point.Payload = payload
+		if i := slices.IndexFunc(c.Points, func(p Point) bool { return p.ID == point.ID }); i >= 0 {
+			c.Points[i] = point
+		} else {
+			c.Points = append(c.Points, point)
+		}
+	}
+	return l.save(name)
+}
+
+func (l *Local) Search(ctx context.Context, name string, req SearchRequest) ([]ScoredPoint, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	c, ok := l.collections[name]
+	if !ok {
+		return nil, fmt.Errorf("qdrant: collection %s does not exist", name)
+	}
+	var hits []ScoredPoint
+	for _, point := range c.Points {
+		if !req.Filter.matches(point.Payload) {
+			continue
+		}
+		score := retrieval.Cosine(req.Vector, point.Vector)
+		if req.ScoreThreshold != nil && score < *req.ScoreThreshold {
+			continue
+		}
+		hit := ScoredPoint{ID: point.ID, Score: score}
+		if req.WithPayload {
+			hit.Payload = point.Payload
+		}
+		hits = append(hits, hit)
+	}
+	slices.SortStableFunc(hits, func(a, b ScoredPoint) int { return cmp.Compare(b.Score, a.Score) })
+	if len(hits) > req.Limit {
+		hits = hits[:req.Limit]
+	}
+	return hits, nil
+}
+
+func (l *Local) save(name string) error {
+	if l.dir == "" {
+		return nil
+	}
+	content, err := json.Marshal(l.collections[name])
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(l.dir, name+".json"), content, 0o644)
+}
+
+// normalizePayload turns the values to what they are after a JSON round trip
+// (numbers to float64 and so on), like the payload Qdrant returns.
+func normalizePayload(payload map[string]any) (map[string]any, error) {
+	if payload == nil {
+		return nil, nil
+	}
+	content, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("qdrant: invalid payload: %v", err)
+	}
+	var normalized map[string]any
+	err = json.Unmarshal(content, &normalized)
+	return normalized, err
+}
+
+func (f *Filter) matches(payload map[string]any) bool {
+	if f == nil {
+		return true
+	}
+	for _, condition := range f.Must {
+		if !condition.matches(payload) {
+			return false
+		}
+	}
+	for _, condition := range f.MustNot {
+		if condition.matches(payload) {
+			return false
+		}
+	}
+	if len(f.Should) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(f.Should, func(c Condition) bool { return c.matches(payload) })
+}
+
+// matches compares the field with the condition, an array field matches when
+// any of its elements does.
+func (c Condition) matches(payload map[string]any) bool {
+	value, ok := payload[c.Key]
+	if !ok {
+		return false
+	}
+	values, isArray := value.([]any)
+	if !isArray {
+		values = []any{value}
+	}
+	return slices.ContainsFunc(values, func(v any) bool {
+		if c.Match != nil {
+			expected := c.Match.Any
+			if expected == nil {
+				expected = []any{c.Match.Value}
+			}
+			if !slices.ContainsFunc(expected, func(e any) bool { return sameValue(v, e) }) {
+				return false
+			}
+		}
+		if c.Range != nil {
+			number, ok := v.(float64)
+			if !ok || !c.Range.contains(number) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func sameValue(a any, b any) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
+
+func (r *Range) contains(v float64) bool {
+	return (r.Gt == nil || v > *r.Gt) && (r.Gte == nil || v >= *r.Gte) &&
+		(r.Lt == nil || v < *r.Lt) && (r.Lte == nil || v <= *r.Lte)
+}
+
+// Handler serves the collections over the Qdrant REST API, so the Client
+// (or any other Qdrant client) can talk to the embedded store.
+func (l *Local) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collections/{name}", func(w http.ResponseWriter, r *http.Request) {
+		l.mu.RLock()
+		defer l.mu.RUnlock()
+		c, ok := l.collections[r.PathValue("name")]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("collection %s does not exist", r.PathValue("name")))
+			return
+		}
+		writeResult(w, map[string]any{"status": "green", "points_count": len(c.Points), "config": map[string]any{"params": map[string]any{"vectors": c.Params}}})
+	})
+	mux.HandleFunc("PUT /collections/{name}", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Vectors VectorParams `json:"vectors"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := l.CreateCollection(r.Context(), r.PathValue("name"), body.Vectors); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeResult(w, true)
+	})
+	mux.HandleFunc("DELETE /collections/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if err := l.DeleteCollection(r.Context(), r.PathValue("name")); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeResult(w, true)
+	})
+	mux.HandleFunc("PUT /collections/{name}/points", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Points []Point `json:"points"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := l.Upsert(r.Context(), r.PathValue("name"), body.Points); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeResult(w, map[string]any{"status": "completed"})
+	})
+	mux.HandleFunc("POST /collections/{name}/points/search", func(w http.ResponseWriter, r *http.Request) {
+		var req SearchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		hits, err := l.Search(r.Context(), r.PathValue("name"), req)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if hits == nil {
+			hits = []ScoredPoint{}
+		}
+		writeResult(w, hits)
+	})
+	return mux
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"result": result, "status": "ok"})
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"status": map[string]string{"error": err.Error()}})
+}
@@ -0,0 +1,141 @@
+// Package qdrant talks to the collections and points API of Qdrant. Client
+// calls a Qdrant server over REST, Local keeps the collections in process (and
+// optionally on disk) and serves the same API, so the tasks and their tests do
+// not need a running server.
+package qdrant
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+const DistanceCosine = "Cosine"
+
+// Store is implemented by Client and Local.
+type Store interface {
+	// CreateCollection creates the collection unless it exists already, an
+	// existing collection with other vector params is an error.
+	CreateCollection(ctx context.Context, name string, params VectorParams) error
+	DeleteCollection(ctx context.Context, name string) error
+	Upsert(ctx context.Context, collection string, points []Point) error
+	Search(ctx context.Context, collection string, req SearchRequest) ([]ScoredPoint, error)
+}
+
+// Open returns the client of the Qdrant server at url, or the embedded store
+// persisted in dir when url is empty.
+func Open(url string, apiKey string, dir string) (Store, error) {
+	if url != "" {
+		return NewClient(url, apiKey), nil
+	}
+	return OpenLocal(dir)
+}
+
+type VectorParams struct {
+	Size     int    `json:"size"`
+	Distance string `json:"distance"`
+}
+
+func checkParams(name string, existing VectorParams, params VectorParams) error {
+	if existing != params {
+		return fmt.Errorf("qdrant: collection %s exists with %d dimensions and %s distance, not %d and %s",
+			name, existing.Size, existing.Distance, params.Size, params.Distance)
+	}
+	return nil
+}
+
+// ID is a point id, Qdrant accepts unsigned integers and UUIDs.
+type ID string
+
+func (id ID) MarshalJSON() ([]byte, error) {
+	if _, err := strconv.ParseUint(string(id), 10, 64); err == nil {
+		return []byte(id), nil
+	}
+	return json.Marshal(string(id))
+}
+
+func (id *ID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = ID(s)
+		return nil
+	}
+	var n uint64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("qdrant: invalid point id %s", string(data))
+	}
+	*id = ID(strconv.FormatUint(n, 10))
+	return nil
+}
+
+// PointID derives a stable UUID from a name like a file name, which Qdrant
+// does not accept as an id itself.
+func PointID(name string) ID {
+	sum := sha1.Sum([]byte(name))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return ID(fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16]))
+}
+
+type Point struct {
+	ID      ID             `json:"id"`
+	Vector  []float32      `json:"vector"`
+	Payload map[string]any `json:"payload,omitempty"`
+}
+
+type ScoredPoint struct {
+	ID      ID             `json:"id"`
+	Score   float64        `json:"score"`
+	Payload map[string]any `json:"payload,omitempty"`
+}
+
+type SearchRequest struct {
+	Vector         []float32 `json:"vector"`
+	Limit          int       `json:"limit"`
+	Filter         *Filter   `json:"filter,omitempty"`
+	WithPayload    bool      `json:"with_payload"`
+	ScoreThreshold *float64  `json:"score_threshold,omitempty"`
+}
+
+// Filter keeps the points matching all Must, at least one Should (when
+// given) and none of MustNot conditions.
+type Filter struct {
+	Must    []Condition `json:"must,omitempty"`
+	Should  []Condition `json:"should,omitempty"`
+	MustNot []Condition `json:"must_not,omitempty"`
+}
+
+// Condition compares the payload field Key with Match or Range.
+type Condition struct {
+	Key   string `json:"key"`
+	Match *Match `json:"match,omitempty"`
+	Range *Range `json:"range,omitempty"`
+}
+
+// Match is either an exact Value or Any of the values.
+type Match struct {
+	Value any   `json:"value,omitempty"`
+	Any   []any `json:"any,omitempty"`
+}
+
+// MarshalJSON keeps false and 0 values, which omitempty would drop.
+func (m Match) MarshalJSON() ([]byte, error) {
+	if m.Any != nil {
+		return json.Marshal(map[string]any{"any": m.Any})
+	}
+	return json.Marshal(map[string]any{"value": m.Value})
+}
+
+type Range struct {
+	Gt  *float64 `json:"gt,omitempty"`
+	Gte *float64 `json:"gte,omitempty"`
+	Lt  *float64 `json:"lt,omitempty"`
+	Lte *float64 `json:"lte,omitempty"`
+}
+
+// MatchValue is the condition of the payload field equal to value.
+func MatchValue(key string, value any) Condition {
+	return Condition{Key: key, Match: &Match{Value: value}}
+}
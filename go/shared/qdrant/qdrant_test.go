@@ -0,0 +1,207 @@
+package qdrant
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"shared/retrieval"
+	"slices"
+	"testing"
+)
+
+type testReport struct {
+	name    string
+	text    string
+	payload map[string]any
+}
+
+var testReports = []testReport{
+	{"a.txt", "patrol zatrzymał nauczyciela w sektorze C4", map[string]any{"sector": "C4", "year": 2024, "dates": []string{"2024-01-08", "2024-01-09"}}},
+	{"b.txt", "naprawiono czujnik ruchu przy bramie", map[string]any{"sector": "A1", "year": 2023, "dates": []string{"2023-11-12"}}},
+	{"c.txt", "czujnik ruchu w sektorze C4 wykrył zwierzynę", map[string]any{"sector": "C4", "year": 2023, "fixed": false}},
+}
+
+func embed(t *testing.T, texts ...string) [][]float32 {
+	t.Helper()
+	vectors, err := (&retrieval.HashEmbedder{Dimensions: 64}).Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vectors
+}
+
+func fill(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+	if err := store.CreateCollection(ctx, "reports", VectorParams{Size: 64, Distance: DistanceCosine}); err != nil {
+		t.Fatal(err)
+	}
+	var points []Point
+	for _, report := range testReports {
+		payload := map[string]any{"name": report.name}
+		for key, value := range report.payload {
+			payload[key] = value
+		}
+		points = append(points, Point{ID: PointID(report.name), Vector: embed(t, report.text)[0], Payload: payload})
+	}
+	if err := store.Upsert(ctx, "reports", points); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func names(points []ScoredPoint) []string {
+	var names []string
+	for _, point := range points {
+		name, _ := point.Payload["name"].(string)
+		names = append(names, name)
+	}
+	return names
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+// testStore runs the same checks against the embedded store and the client.
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	fill(t, store)
+
+	if err := store.CreateCollection(ctx, "reports", VectorParams{Size: 64, Distance: DistanceCosine}); err != nil {
+		t.Errorf("creating an existing collection: %v", err)
+	}
+	if err := store.CreateCollection(ctx, "reports", VectorParams{Size: 128, Distance: DistanceCosine}); err == nil {
+		t.Error("creating a collection with other params succeeded")
+	}
+
+	query := embed(t, "czujnik ruchu")[0]
+	tests := []struct {
+		name   string
+		filter *Filter
+		want   []string
+	}{
+		{"no filter", nil, []string{"b.txt", "c.txt", "a.txt"}},
+		{"must", &Filter{Must: []Condition{MatchValue("sector", "C4")}}, []string{"c.txt", "a.txt"}},
+		{"must not", &Filter{MustNot: []Condition{MatchValue("sector", "C4")}}, []string{"b.txt"}},
+		{"should", &Filter{Should: []Condition{MatchValue("sector", "A1"), MatchValue("year", 2024)}}, []string{"b.txt", "a.txt"}},
+		{"array element", &Filter{Must: []Condition{MatchValue("dates", "2024-01-09")}}, []string{"a.txt"}},
+		{"any", &Filter{Must: []Condition{{Key: "dates", Match: &Match{Any: []any{"2023-11-12", "2024-01-08"}}}}}, []string{"b.txt", "a.txt"}},
+		{"false value", &Filter{Must: []Condition{MatchValue("fixed", false)}}, []string{"c.txt"}},
+		{"range", &Filter{Must: []Condition{{Key: "year", Range: &Range{Gte: float(2024)}}}}, []string{"a.txt"}},
+		{"missing field", &Filter{Must: []Condition{MatchValue("author", "x")}}, nil},
+	}
+	for _, test := range tests {
+		found, err := store.Search(ctx, "reports", SearchRequest{Vector: query, Limit: 10, Filter: test.filter, WithPayload: true})
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := names(found); !slices.Equal(got, test.want) {
+			t.Errorf("%s: found %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	found, err := store.Search(ctx, "reports", SearchRequest{Vector: query, Limit: 1, WithPayload: true})
+	if err != nil || len(found) != 1 || found[0].ID != PointID("b.txt") {
+		t.Errorf("search with limit 1 = %v, %v", found, err)
+	}
+	if year, _ := found[0].Payload["year"].(float64); year != 2023 {
+		t.Errorf("payload year = %v, want 2023", found[0].Payload["year"])
+	}
+
+	// an upsert of an existing id replaces the point
+	if err := store.Upsert(ctx, "reports", []Point{{ID: PointID("b.txt"), Vector: query, Payload: map[string]any{"name": "b.txt"}}}); err != nil {
+		t.Fatal(err)
+	}
+	found, err = store.Search(ctx, "reports", SearchRequest{Vector: query, Limit: 10})
+	if err != nil || len(found) != 3 || found[0].Score < 0.999 {
+		t.Errorf("search after the upsert = %v, %v", found, err)
+	}
+	if err := store.Upsert(ctx, "reports", []Point{{ID: "1", Vector: []float32{1}}}); err == nil {
+		t.Error("upsert of a vector with other dimensions succeeded")
+	}
+
+	if err := store.DeleteCollection(ctx, "reports"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteCollection(ctx, "reports"); err != nil {
+		t.Errorf("deleting a missing collection: %v", err)
+	}
+	if _, err := store.Search(ctx, "reports", SearchRequest{Vector: query, Limit: 1}); err == nil {
+		t.Error("search in a deleted collection succeeded")
+	}
+}
+
+func TestLocal(t *testing.T) {
+	store, err := OpenLocal("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
+
+func TestClientWithLocalHandler(t *testing.T) {
+	local, err := OpenLocal("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(local.Handler())
+	defer server.Close()
+	testStore(t, NewClient(server.URL, "key"))
+}
+
+func TestLocalPersistence(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, store)
+
+	reopened, err := OpenLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := reopened.Search(context.Background(), "reports", SearchRequest{
+		Vector: embed(t, "czujnik ruchu")[0], Limit: 10, WithPayload: true,
+		Filter: &Filter{Must: []Condition{MatchValue("sector", "C4")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(found); !slices.Equal(got, []string{"c.txt", "a.txt"}) {
+		t.Errorf("found %v after reopening, want [c.txt a.txt]", got)
+	}
+}
+
+func TestID(t *testing.T) {
+	if PointID("a.txt") != PointID("a.txt") || PointID("a.txt") == PointID("b.txt") {
+		t.Error("PointID is not stable")
+	}
+	if id := PointID("a.txt"); len(id) != 36 || id[14] != '5' {
+		t.Errorf("PointID = %s, want a version 5 UUID", id)
+	}
+	for _, test := range []struct {
+		id   ID
+		json string
+	}{{"42", "42"}, {PointID("a.txt"), `"` + string(PointID("a.txt")) + `"`}} {
+		encoded, err := json.Marshal(test.id)
+		if err != nil || string(encoded) != test.json {
+			t.Errorf("Marshal(%s) = %s, %v, want %s", test.id, encoded, err, test.json)
+		}
+		var decoded ID
+		if err := json.Unmarshal(encoded, &decoded); err != nil || decoded != test.id {
+			t.Errorf("Unmarshal(%s) = %s, %v", encoded, decoded, err)
+		}
+	}
+}
+
+func TestMatchKeepsZeroValues(t *testing.T) {
+	encoded, err := json.Marshal(MatchValue("fixed", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"key":"fixed","match":{"value":false}}`; string(encoded) != want {
+		t.Errorf("Marshal = %s, want %s", encoded, want)
+	}
+}
@@ -0,0 +1,125 @@
+package retrieval
+
+import (
+	"cmp"
+	"math"
+	"shared/polish"
+	"slices"
+	"strings"
+)
+
+// stemLength is the number of letters kept of the words unknown to the
+// lemmatizer, most Polish endings are cut off by it.
+const stemLength = 6
+
+var stopWords = map[string]bool{
+	"a": true, "aby": true, "ale": true, "bo": true, "by": true, "być": true, "czy": true, "do": true,
+	"gdzie": true, "i": true, "ich": true, "jak": true, "jaki": true, "jest": true, "jego": true, "jej": true,
+	"już": true, "kto": true, "który": true, "która": true, "które": true, "którego": true, "którym": true,
+	"lub": true, "na": true, "nie": true, "o": true, "od": true, "oraz": true, "po": true, "pod": true,
+	"przez": true, "przy": true, "się": true, "są": true, "ta": true, "tak": true, "te": true, "to": true,
+	"w": true, "we": true, "z": true, "za": true, "ze": true, "że": true, "co": true,
+}
+
+// Analyzer turns a text into the terms of the BM25 index.
+type Analyzer func(text string) []string
+
+// PolishAnalyzer drops the stop words, replaces every word with its
+// nominative form when the lemmatizer knows it and keeps only the first
+// letters of the result, so "prototypu" and "prototyp" are the same term
+// even when the lemmatizer does not know them. Words with digits, like part
+// numbers, are kept as they are.
+func PolishAnalyzer(lemmatizer *polish.Lemmatizer) Analyzer {
+	return func(text string) []string {
+		var terms []string
+		for _, token := range polish.Tokenize(text) {
+			if stopWords[token] {
+				continue
+			}
+			if lemmatizer != nil {
+				if lemma, ok := lemmatizer.Lemma(token); ok {
+					token = lemma
+				}
+			}
+			if runes := []rune(token); len(runes) > stemLength && !strings.ContainsAny(token, "0123456789") {
+				token = string(runes[:stemLength])
+			}
+			terms = append(terms, token)
+		}
+		return terms
+	}
+}
+
+type posting struct {
+	doc       int
+	frequency int
+}
+
+// BM25Index is an inverted index of the documents scored with Okapi BM25.
+type BM25Index struct {
+	K1       float64
+	B        float64
+	analyzer Analyzer
+	docs     []Document
+	lengths  []int
+	average  float64
+	postings map[string][]posting
+}
+
+func NewBM25Index(docs []Document, analyzer Analyzer) *BM25Index {
+	ix := &BM25Index{K1: 1.2, B: 0.75, analyzer: analyzer, docs: docs, postings: make(map[string][]posting)}
+	total := 0
+	for i, doc := range docs {
+		frequencies := make(map[string]int)
+		terms := analyzer(doc.Text)
+		for _, term := range terms {
+			frequencies[term]++
+		}
+		for term, frequency := range frequencies {
+			ix.postings[term] = append(ix.postings[term], posting{doc: i, frequency: frequency})
+		}
+		ix.lengths = append(ix.lengths, len(terms))
+		total += len(terms)
+	}
+	if len(docs) > 0 {
+		ix.average = float64(total) / float64(len(docs))
+	}
+	return ix
+}
+
+// Search returns up to k documents with the metadata filters (see
+// MatchMetadata) containing the terms of the query, best first.
+func (ix *BM25Index) Search(query string, k int, filters map[string]string) []Hit {
+	scores := make(map[int]float64)
+	seen := make(map[string]bool)
+	for _, term := range ix.analyzer(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		postings := ix.postings[term]
+		idf := math.Log(1 + (float64(len(ix.docs))-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+		for _, p := range postings {
+			frequency := float64(p.frequency)
+			norm := ix.K1 * (1 - ix.B + ix.B*float64(ix.lengths[p.doc])/ix.average)
+			scores[p.doc] += idf * frequency * (ix.K1 + 1) / (frequency + norm)
+		}
+	}
+
+	var hits []Hit
+	for doc, score := range scores {
+		if MatchMetadata(ix.docs[doc], filters) {
+			hits = append(hits, Hit{Document: ix.docs[doc], Score: score})
+		}
+	}
+	slices.SortFunc(hits, func(a, b Hit) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
@@ -0,0 +1,143 @@
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"shared/polish"
+	"strings"
+)
+
+// OpenAIEmbedder calls an OpenAI compatible /embeddings endpoint.
+type OpenAIEmbedder struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	Client  *http.Client
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	body := map[string]any{"model": e.Model, "input": texts}
+	if err := postJSON(ctx, e.Client, strings.TrimSuffix(e.BaseURL, "/")+"/embeddings", e.APIKey, body, &resp); err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(texts))
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= len(vectors) {
+			return nil, fmt.Errorf("retrieval: unexpected embedding index %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// OllamaEmbedder calls the /api/embed endpoint of Ollama.
+type OllamaEmbedder struct {
+	Host   string
+	Model  string
+	Client *http.Client
+}
+
+func (e *OllamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	body := map[string]any{"model": e.Model, "input": texts}
+	if err := postJSON(ctx, e.Client, strings.TrimSuffix(e.Host, "/")+"/api/embed", "", body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Embeddings, nil
+}
+
+// HashEmbedder hashes the words and word bigrams of the text into a vector of
+// Dimensions. It needs no model, so it works offline and in tests, but it only
+// matches shared words, not meaning.
+type HashEmbedder struct {
+	Dimensions int
+}
+
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	dimensions := e.Dimensions
+	if dimensions <= 0 {
+		dimensions = 512
+	}
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, dimensions)
+		tokens := polish.Tokenize(text)
+		for j, token := range tokens {
+			addFeature(vector, token, 1)
+			if j > 0 {
+				addFeature(vector, tokens[j-1]+" "+token, 0.5)
+			}
+		}
+		var norm float64
+		for _, value := range vector {
+			norm += float64(value) * float64(value)
+		}
+		if norm > 0 {
+			for k := range vector {
+				vector[k] = float32(float64(vector[k]) / math.Sqrt(norm))
+			}
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+func addFeature(vector []float32, feature string, weight float32) {
+	h := fnv.New32a()
+	h.Write([]byte(feature))
+	sum := h.Sum32()
+	// the highest bit decides the sign, so collisions cancel out instead of adding up
+	if sum&(1<<31) != 0 {
+		weight = -weight
+	}
+	vector[int(sum%uint32(len(vector)))] += weight
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, apiKey string, body any, result any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("retrieval: calling %s failed | %d | %s", url, resp.StatusCode, string(respBody))
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("retrieval: could not decode response of %s: %v", url, err)
+	}
+	return nil
+}
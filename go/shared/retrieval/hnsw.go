@@ -0,0 +1,159 @@
+package retrieval
+
+import (
+	"cmp"
+	"math"
+	"math/rand"
+	"slices"
+)
+
+// HNSW is a hierarchical navigable small world graph over the vectors of a
+// VectorIndex. Nodes are the positions of the entries, so the graph is only
+// valid for the entries it was built from.
+type HNSW struct {
+	M              int `json:"m"`
+	EfConstruction int `json:"ef_construction"`
+	EfSearch       int `json:"ef_search"`
+	Entry          int `json:"entry"`
+	// Layers[node][level] are the neighbours of node on the level.
+	Layers [][][]int `json:"layers"`
+}
+
+type candidate struct {
+	node     int
+	distance float64
+}
+
+// BuildHNSW builds the graph over the entries, m is the number of neighbours
+// per node and ef the size of the candidate list while building and searching.
+// The same seed builds the same graph.
+func (ix *VectorIndex) BuildHNSW(m int, ef int, seed int64) {
+	graph := &HNSW{M: m, EfConstruction: ef, EfSearch: ef, Entry: -1}
+	random := rand.New(rand.NewSource(seed))
+	levelFactor := 1 / math.Log(float64(max(m, 2)))
+	for node := range ix.Entries {
+		level := int(-math.Log(1-random.Float64()) * levelFactor)
+		graph.insert(ix, node, level)
+	}
+	ix.Graph = graph
+}
+
+func (g *HNSW) distance(ix *VectorIndex, vector []float32, node int) float64 {
+	return 1 - Cosine(vector, ix.Entries[node].Vector)
+}
+
+func (g *HNSW) maxLevel() int {
+	if g.Entry < 0 {
+		return -1
+	}
+	return len(g.Layers[g.Entry]) - 1
+}
+
+func (g *HNSW) insert(ix *VectorIndex, node int, level int) {
+	g.Layers = append(g.Layers, make([][]int, level+1))
+	if g.Entry < 0 {
+		g.Entry = node
+		return
+	}
+	vector := ix.Entries[node].Vector
+	entry := []candidate{{g.Entry, g.distance(ix, vector, g.Entry)}}
+	top := g.maxLevel()
+	for l := top; l > level; l-- {
+		entry = g.searchLayer(ix, vector, entry, 1, l)
+	}
+	for l := min(level, top); l >= 0; l-- {
+		found := g.searchLayer(ix, vector, entry, g.EfConstruction, l)
+		neighbours := g.closest(found, g.maxNeighbours(l))
+		for _, neighbour := range neighbours {
+			g.Layers[node][l] = append(g.Layers[node][l], neighbour.node)
+			g.connect(ix, neighbour.node, node, l)
+		}
+		entry = found
+	}
+	if level > top {
+		g.Entry = node
+	}
+}
+
+// connect adds the edge from node to neighbour and keeps only the closest
+// neighbours when the node has too many.
+func (g *HNSW) connect(ix *VectorIndex, node int, neighbour int, level int) {
+	links := append(g.Layers[node][level], neighbour)
+	if len(links) > g.maxNeighbours(level) {
+		vector := ix.Entries[node].Vector
+		candidates := make([]candidate, len(links))
+		for i, link := range links {
+			candidates[i] = candidate{link, g.distance(ix, vector, link)}
+		}
+		links = links[:0]
+		for _, c := range g.closest(candidates, g.maxNeighbours(level)) {
+			links = append(links, c.node)
+		}
+	}
+	g.Layers[node][level] = links
+}
+
+func (g *HNSW) maxNeighbours(level int) int {
+	if level == 0 {
+		return 2 * g.M
+	}
+	return g.M
+}
+
+func (g *HNSW) closest(candidates []candidate, n int) []candidate {
+	sorted := slices.Clone(candidates)
+	slices.SortStableFunc(sorted, func(a, b candidate) int { return cmp.Compare(a.distance, b.distance) })
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// searchLayer is the greedy best first search of the level, it returns up to
+// ef nodes closest to the vector, nearest first.
+func (g *HNSW) searchLayer(ix *VectorIndex, vector []float32, entry []candidate, ef int, level int) []candidate {
+	visited := make(map[int]bool)
+	var queue, found []candidate
+	for _, c := range entry {
+		visited[c.node] = true
+		queue = append(queue, c)
+		found = append(found, c)
+	}
+	found = g.closest(found, ef)
+	for len(queue) > 0 {
+		slices.SortStableFunc(queue, func(a, b candidate) int { return cmp.Compare(a.distance, b.distance) })
+		current := queue[0]
+		queue = queue[1:]
+		if len(found) >= ef && current.distance > found[len(found)-1].distance {
+			break
+		}
+		for _, neighbour := range g.Layers[current.node][level] {
+			if visited[neighbour] {
+				continue
+			}
+			visited[neighbour] = true
+			c := candidate{neighbour, g.distance(ix, vector, neighbour)}
+			if len(found) < ef || c.distance < found[len(found)-1].distance {
+				queue = append(queue, c)
+				found = g.closest(append(found, c), ef)
+			}
+		}
+	}
+	return found
+}
+
+func (g *HNSW) search(ix *VectorIndex, vector []float32, k int) []Hit {
+	if g.Entry < 0 {
+		return nil
+	}
+	entry := []candidate{{g.Entry, g.distance(ix, vector, g.Entry)}}
+	for l := g.maxLevel(); l > 0; l-- {
+		entry = g.searchLayer(ix, vector, entry, 1, l)
+	}
+	found := g.searchLayer(ix, vector, entry, max(g.EfSearch, k), 0)
+	var hits []Hit
+	for _, c := range g.closest(found, k) {
+		hits = append(hits, Hit{Document: ix.Entries[c.node].Document, Score: 1 - c.distance})
+	}
+	return hits
+}
@@ -0,0 +1,178 @@
+package retrieval
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// VectorStore is searched by the vector of the query, VectorIndex and the
+// adapters of external stores like Qdrant implement it.
+type VectorStore interface {
+	SearchVector(ctx context.Context, vector []float32, k int, filters map[string]string) ([]Hit, error)
+}
+
+func (ix *VectorIndex) SearchVector(ctx context.Context, vector []float32, k int, filters map[string]string) ([]Hit, error) {
+	return ix.SearchFiltered(vector, k, filters), nil
+}
+
+// Reranker orders the hits by their relevance to the query.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, hits []Hit) ([]Hit, error)
+}
+
+// HybridSearcher finds documents both by keywords and by meaning. Either of
+// Vector and Keywords can be nil to search only the other way.
+type HybridSearcher struct {
+	Vector   VectorStore
+	Embedder Embedder
+	Keywords *BM25Index
+	Reranker Reranker
+	// Candidates is the number of hits taken from each search before the
+	// fusion and given to the reranker, 4*k when zero.
+	Candidates int
+}
+
+// Search returns up to k documents with the metadata filters (see
+// MatchMetadata). The keyword and vector hits are fused with reciprocal rank
+// fusion when both are searched and reranked when there is a Reranker.
+func (s *HybridSearcher) Search(ctx context.Context, query string, k int, filters map[string]string) ([]Hit, error) {
+	candidates := s.Candidates
+	if candidates <= 0 {
+		candidates = 4 * k
+	}
+	var lists [][]Hit
+	if s.Keywords != nil {
+		lists = append(lists, s.Keywords.Search(query, candidates, filters))
+	}
+	if s.Vector != nil {
+		vectors, err := s.Embedder.Embed(ctx, []string{query})
+		if err != nil {
+			return nil, fmt.Errorf("retrieval: could not embed query: %v", err)
+		}
+		if len(vectors) != 1 {
+			return nil, fmt.Errorf("retrieval: got %d vectors for the query", len(vectors))
+		}
+		hits, err := s.Vector.SearchVector(ctx, vectors[0], candidates, filters)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, hits)
+	}
+	var hits []Hit
+	if len(lists) == 1 {
+		hits = lists[0]
+	} else {
+		hits = FuseRRF(lists...)
+	}
+	if len(hits) > candidates {
+		hits = hits[:candidates]
+	}
+	if s.Reranker != nil && len(hits) > 1 {
+		reranked, err := s.Reranker.Rerank(ctx, query, hits)
+		if err != nil {
+			return nil, fmt.Errorf("retrieval: could not rerank: %v", err)
+		}
+		hits = reranked
+	}
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits, nil
+}
+
+// rrfK dampens the weight of the top ranks, 60 is the value of the original
+// paper.
+const rrfK = 60
+
+// FuseRRF merges ranked lists of hits by reciprocal rank fusion, the score of
+// a document is the sum of 1/(60+rank) over the lists it is in.
+func FuseRRF(lists ...[]Hit) []Hit {
+	scores := make(map[string]float64)
+	docs := make(map[string]Document)
+	var order []string
+	for _, list := range lists {
+		for rank, hit := range list {
+			if _, ok := docs[hit.ID]; !ok {
+				docs[hit.ID] = hit.Document
+				order = append(order, hit.ID)
+			}
+			scores[hit.ID] += 1 / float64(rrfK+rank+1)
+		}
+	}
+	hits := make([]Hit, 0, len(order))
+	for _, id := range order {
+		hits = append(hits, Hit{Document: docs[id], Score: scores[id]})
+	}
+	slices.SortStableFunc(hits, func(a, b Hit) int { return cmp.Compare(b.Score, a.Score) })
+	return hits
+}
+
+// LLMReranker asks a language model to rate the relevance of every hit from 0
+// to 10. Complete sends the prompt to the model of the task and returns its
+// answer, which should be JSON.
+type LLMReranker struct {
+	Complete func(ctx context.Context, prompt string) (string, error)
+	// MaxChars limits the text of a hit in the prompt, 2000 when zero.
+	MaxChars int
+}
+
+func (r *LLMReranker) Rerank(ctx context.Context, query string, hits []Hit) ([]Hit, error) {
+	maxChars := r.MaxChars
+	if maxChars <= 0 {
+		maxChars = 2000
+	}
+	var prompt strings.Builder
+	prompt.WriteString("Rate how relevant every document below is to the question, from 0 (not at all) to 10 (answers it). " +
+		"Answer with JSON object {\"scores\": [{\"document\": <number>, \"score\": <0-10>}]} with every document.\n\n")
+	fmt.Fprintf(&prompt, "Question: %s\n", query)
+	for i, hit := range hits {
+		text := []rune(hit.Text)
+		if len(text) > maxChars {
+			text = text[:maxChars]
+		}
+		fmt.Fprintf(&prompt, "\nDocument %d:\n%s\n", i, string(text))
+	}
+
+	answer, err := r.Complete(ctx, prompt.String())
+	if err != nil {
+		return nil, err
+	}
+	var rating struct {
+		Scores []struct {
+			Document int     `json:"document"`
+			Score    float64 `json:"score"`
+		} `json:"scores"`
+	}
+	start, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON in the answer %q", answer)
+	}
+	if err := json.Unmarshal([]byte(answer[start:end+1]), &rating); err != nil {
+		return nil, fmt.Errorf("could not parse the answer %q: %v", answer, err)
+	}
+
+	// documents the model did not rate keep their fused order behind the rated ones
+	scores := make([]float64, len(hits))
+	for i := range scores {
+		scores[i] = -1
+	}
+	for _, s := range rating.Scores {
+		if s.Document >= 0 && s.Document < len(hits) {
+			scores[s.Document] = s.Score
+		}
+	}
+	order := make([]int, len(hits))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(scores[b], scores[a]) })
+	reranked := make([]Hit, len(hits))
+	for i, j := range order {
+		reranked[i] = Hit{Document: hits[j].Document, Score: max(scores[j], 0) / 10}
+	}
+	return reranked, nil
+}
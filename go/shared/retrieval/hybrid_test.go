@@ -0,0 +1,165 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"math"
+	"shared/polish"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func ids(hits []Hit) []string {
+	var ids []string
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func TestPolishAnalyzer(t *testing.T) {
+	analyze := PolishAnalyzer(polish.NewLemmatizer())
+	got := analyze("Nauczycielki w sektorze przy prototypie XK-1024 i prototyp")
+	want := []string{"nauczy", "sektor", "protot", "xk", "1024", "protot"}
+	if !slices.Equal(got, want) {
+		t.Errorf("terms = %v, want %v", got, want)
+	}
+}
+
+func TestBM25Search(t *testing.T) {
+	docs := []Document{
+		{ID: "a", Text: "Prototyp broni testowano w laboratorium", Metadata: map[string]string{"date": "2024-01-08"}},
+		{ID: "b", Text: "Laboratorium zamknięto, prototypu nie odnaleziono, prototypu szukano", Metadata: map[string]string{"date": "2024-01-09"}},
+		{ID: "c", Text: "Patrol w sektorze C4 bez zdarzeń", Metadata: map[string]string{"date": "2024-01-09"}},
+		{ID: "d", Text: "Numer części XK-1024 zamówiono ponownie"},
+	}
+	index := NewBM25Index(docs, PolishAnalyzer(polish.NewLemmatizer()))
+	tests := []struct {
+		query   string
+		filters map[string]string
+		want    []string
+	}{
+		{"prototypów", nil, []string{"b", "a"}},
+		{"prototyp", map[string]string{"date": "2024-01-08"}, []string{"a"}},
+		{"1024", nil, []string{"d"}},
+		{"gdzie jest", nil, nil},
+		{"nieznane słowo", nil, nil},
+	}
+	for _, test := range tests {
+		if got := ids(index.Search(test.query, 10, test.filters)); !slices.Equal(got, test.want) {
+			t.Errorf("Search(%q, %v) = %v, want %v", test.query, test.filters, got, test.want)
+		}
+	}
+	if hits := index.Search("laboratorium prototyp", 1, nil); len(hits) != 1 {
+		t.Errorf("Search with k 1 returned %d hits", len(hits))
+	}
+}
+
+func TestFuseRRF(t *testing.T) {
+	hits := func(ids ...string) []Hit {
+		var hits []Hit
+		for _, id := range ids {
+			hits = append(hits, Hit{Document: Document{ID: id}})
+		}
+		return hits
+	}
+	fused := FuseRRF(hits("a", "b", "c"), hits("c", "b", "d"))
+	// c is third and first, which beats second twice
+	if got, want := ids(fused), []string{"c", "b", "a", "d"}; !slices.Equal(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+	if want := 1.0/63 + 1.0/61; math.Abs(fused[0].Score-want) > 1e-12 {
+		t.Errorf("score of c = %v, want %v", fused[0].Score, want)
+	}
+	if got := ids(FuseRRF(hits("x", "y"))); !slices.Equal(got, []string{"x", "y"}) {
+		t.Errorf("single list = %v", got)
+	}
+}
+
+// reverseReranker returns the hits in the opposite order and remembers how
+// many it got.
+type reverseReranker struct {
+	got int
+}
+
+func (r *reverseReranker) Rerank(ctx context.Context, query string, hits []Hit) ([]Hit, error) {
+	r.got = len(hits)
+	reversed := slices.Clone(hits)
+	slices.Reverse(reversed)
+	return reversed, nil
+}
+
+func TestHybridSearcher(t *testing.T) {
+	ctx := context.Background()
+	docs := []Document{
+		{ID: "a", Text: "czujnik ruchu przy bramie zachodniej"},
+		{ID: "b", Text: "ruchu drogowego nie było"},
+		{ID: "c", Text: "czujnik temperatury w magazynie"},
+		{ID: "d", Text: "patrol w lesie"},
+	}
+	embedder := &HashEmbedder{Dimensions: 256}
+	vectors, err := BuildVectorIndex(ctx, embedder, "hash:256", docs, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keywords := NewBM25Index(docs, PolishAnalyzer(nil))
+
+	searcher := &HybridSearcher{Vector: vectors, Embedder: embedder, Keywords: keywords}
+	hits, err := searcher.Search(ctx, "czujnik ruchu", 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(hits); len(got) != 2 || got[0] != "a" {
+		t.Errorf("hybrid = %v, want a first", got)
+	}
+
+	// without fusion the scores of the single list are kept
+	keywordsOnly := &HybridSearcher{Keywords: keywords}
+	hits, err = keywordsOnly.Search(ctx, "magazynie", 5, nil)
+	if err != nil || len(hits) != 1 || hits[0].ID != "c" || hits[0].Score != keywords.Search("magazynie", 1, nil)[0].Score {
+		t.Errorf("keywords only = %v, %v", hits, err)
+	}
+
+	reranker := &reverseReranker{}
+	reranked := &HybridSearcher{Vector: vectors, Embedder: embedder, Keywords: keywords, Reranker: reranker, Candidates: 3}
+	hits, err = reranked.Search(ctx, "czujnik ruchu", 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reranker.got != 3 || len(hits) != 2 || hits[0].ID == "a" {
+		t.Errorf("reranker got %d candidates and returned %v", reranker.got, ids(hits))
+	}
+}
+
+func TestLLMReranker(t *testing.T) {
+	hits := []Hit{{Document: Document{ID: "a", Text: "pierwszy"}}, {Document: Document{ID: "b", Text: "drugi"}}, {Document: Document{ID: "c", Text: strings.Repeat("x", 50)}}}
+	var prompt string
+	reranker := &LLMReranker{MaxChars: 10, Complete: func(ctx context.Context, p string) (string, error) {
+		prompt = p
+		return "```json\n{\"scores\": [{\"document\": 1, \"score\": 9}, {\"document\": 0, \"score\": 3}, {\"document\": 7, \"score\": 10}]}\n```", nil
+	}}
+	reranked, err := reranker.Rerank(context.Background(), "pytanie", hits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the unrated document keeps its place behind the rated ones
+	if got := ids(reranked); !slices.Equal(got, []string{"b", "a", "c"}) {
+		t.Errorf("order = %v, want [b a c]", got)
+	}
+	if reranked[0].Score != 0.9 || reranked[2].Score != 0 {
+		t.Errorf("scores = %v, %v", reranked[0].Score, reranked[2].Score)
+	}
+	if strings.Contains(prompt, strings.Repeat("x", 11)) {
+		t.Error("the text of a hit was not cut to MaxChars")
+	}
+
+	failing := &LLMReranker{Complete: func(ctx context.Context, p string) (string, error) { return "nie wiem", nil }}
+	if _, err := failing.Rerank(context.Background(), "pytanie", hits); err == nil {
+		t.Error("an answer without JSON was accepted")
+	}
+	broken := &LLMReranker{Complete: func(ctx context.Context, p string) (string, error) { return "", errors.New("timeout") }}
+	if _, err := broken.Rerank(context.Background(), "pytanie", hits); err == nil {
+		t.Error("the error of the model was ignored")
+	}
+}
@@ -0,0 +1,123 @@
+package retrieval
+
+import (
+	"fmt"
+	"regexp"
+	"shared/polish"
+	"slices"
+	"strings"
+)
+
+// FilePattern reads the metadata Key from file names matching Regexp. The
+// value is Template expanded with the groups of the match (e.g.
+// "${year}-${month}-${day}"), or the first group when Template is empty.
+type FilePattern struct {
+	Key      string
+	Regexp   *regexp.Regexp
+	Template string
+}
+
+// DefaultFilePatterns read the date, sector and report number of names like
+// 2024_01_08.txt or 2024-11-12_report-00-sektor_C4.txt.
+var DefaultFilePatterns = []FilePattern{
+	{Key: "date", Regexp: regexp.MustCompile(`(?P<year>\d{4})[-_](?P<month>\d{2})[-_](?P<day>\d{2})`), Template: "${year}-${month}-${day}"},
+	{Key: "sector", Regexp: regexp.MustCompile(`(?i)sektor[-_ ]?([A-Z0-9]+)`)},
+	{Key: "report", Regexp: regexp.MustCompile(`(?i)report[-_ ]?(\d+)`)},
+}
+
+// ParseFilePattern reads a pattern given as key=regexp or
+// key=template=regexp, e.g. on the command line. The template must refer to
+// the groups with $, otherwise everything after the key is the regexp, which
+// may contain = as well.
+func ParseFilePattern(spec string) (FilePattern, error) {
+	key, expr, ok := strings.Cut(spec, "=")
+	if !ok || key == "" {
+		return FilePattern{}, fmt.Errorf("retrieval: invalid file pattern %q, use key=regexp or key=template=regexp", spec)
+	}
+	pattern := FilePattern{Key: key}
+	if template, rest, ok := strings.Cut(expr, "="); ok && strings.Contains(template, "$") {
+		pattern.Template, expr = template, rest
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return FilePattern{}, fmt.Errorf("retrieval: invalid file pattern %q: %v", spec, err)
+	}
+	pattern.Regexp = re
+	return pattern, nil
+}
+
+// MetadataExtractor reads metadata from file names and dates from the text
+// of the documents.
+type MetadataExtractor struct {
+	Patterns []FilePattern
+}
+
+func NewMetadataExtractor(patterns ...FilePattern) *MetadataExtractor {
+	if len(patterns) == 0 {
+		patterns = DefaultFilePatterns
+	}
+	return &MetadataExtractor{Patterns: patterns}
+}
+
+// FromFileName returns the metadata of the patterns matching the name, the
+// first pattern of a key wins.
+func (e *MetadataExtractor) FromFileName(name string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pattern := range e.Patterns {
+		if _, ok := metadata[pattern.Key]; ok {
+			continue
+		}
+		match := pattern.Regexp.FindStringSubmatchIndex(name)
+		if match == nil {
+			continue
+		}
+		var value string
+		switch {
+		case pattern.Template != "":
+			value = string(pattern.Regexp.ExpandString(nil, pattern.Template, name, match))
+		case len(match) > 2 && match[2] >= 0:
+			value = name[match[2]:match[3]]
+		default:
+			value = name[match[0]:match[1]]
+		}
+		metadata[pattern.Key] = value
+	}
+	return metadata
+}
+
+// Extract returns the metadata of the file name with "file" set to the name
+// and "dates" to the dates mentioned in the text, comma separated.
+func (e *MetadataExtractor) Extract(name string, text string) map[string]string {
+	metadata := e.FromFileName(name)
+	metadata["file"] = name
+	var dates []string
+	for _, date := range polish.FindDates(text) {
+		if !slices.Contains(dates, date.Value) {
+			dates = append(dates, date.Value)
+		}
+	}
+	if len(dates) > 0 {
+		metadata["dates"] = strings.Join(dates, ",")
+	}
+	return metadata
+}
+
+// Document returns the document of the file with its metadata attached.
+func (e *MetadataExtractor) Document(name string, text string) Document {
+	return Document{ID: name, Text: text, Metadata: e.Extract(name, text)}
+}
+
+// MatchMetadata reports whether the document has all the filters, a filter of
+// a comma separated key (like "dates") matches any of its values.
+func MatchMetadata(doc Document, filters map[string]string) bool {
+	for key, value := range filters {
+		actual, ok := doc.Metadata[key]
+		if !ok {
+			return false
+		}
+		if actual != value && !slices.Contains(strings.Split(actual, ","), value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package retrieval
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseFilePattern(t *testing.T) {
+	tests := []struct {
+		spec     string
+		key      string
+		template string
+		expr     string
+	}{
+		{`sector=sektor_(\w+)`, "sector", "", `sektor_(\w+)`},
+		{`date=${1}-${2}-${3}=(\d{4})_(\d{2})_(\d{2})`, "date", "${1}-${2}-${3}", `(\d{4})_(\d{2})_(\d{2})`},
+		{`kind=type=(\w+)`, "kind", "", `type=(\w+)`},
+	}
+	for _, test := range tests {
+		pattern, err := ParseFilePattern(test.spec)
+		if err != nil {
+			t.Errorf("ParseFilePattern(%q): %v", test.spec, err)
+			continue
+		}
+		if pattern.Key != test.key || pattern.Template != test.template || pattern.Regexp.String() != test.expr {
+			t.Errorf("ParseFilePattern(%q) = %q, %q, %q", test.spec, pattern.Key, pattern.Template, pattern.Regexp)
+		}
+	}
+	for _, spec := range []string{"", "=abc", "key", "key=("} {
+		if _, err := ParseFilePattern(spec); err == nil {
+			t.Errorf("ParseFilePattern(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestFromFileName(t *testing.T) {
+	extractor := NewMetadataExtractor()
+	tests := map[string]map[string]string{
+		"2024-11-12_report-00-sektor_C4.txt": {"date": "2024-11-12", "report": "00", "sector": "C4"},
+		"2024_01_08.txt":                     {"date": "2024-01-08"},
+		"notatka.txt":                        {},
+	}
+	for name, want := range tests {
+		if got := extractor.FromFileName(name); !maps.Equal(got, want) {
+			t.Errorf("FromFileName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package retrieval
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"slices"
+)
+
+// Document is a retrievable piece of text, e.g. a chunk of an article.
+type Document struct {
+	ID       string            `json:"id"`
+	Text     string            `json:"text"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Embedder turns texts into vectors. The HTTP based backends are in
+// embedders.go, the ones needing a provider SDK live in the tasks.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+type Hit struct {
+	Document
+	Score float64 `json:"score"`
+}
+
+type vectorEntry struct {
+	Document Document  `json:"document"`
+	Vector   []float32 `json:"vector"`
+}
+
+// VectorIndex is a small in-memory index searched with cosine similarity. It
+// is meant for hundreds or thousands of documents, which fit in a JSON file.
+// With the optional HNSW graph the search visits only a part of the entries.
+type VectorIndex struct {
+	Model   string        `json:"model"`
+	Entries []vectorEntry `json:"entries"`
+	Graph   *HNSW         `json:"graph,omitempty"`
+}
+
+func NewVectorIndex(model string) *VectorIndex {
+	return &VectorIndex{Model: model}
+}
+
+// BuildVectorIndex embeds the documents in batches of batchSize.
+func BuildVectorIndex(ctx context.Context, embedder Embedder, model string, docs []Document, batchSize int) (*VectorIndex, error) {
+	index := NewVectorIndex(model)
+	for start := 0; start < len(docs); start += batchSize {
+		end := min(start+batchSize, len(docs))
+		var texts []string
+		for _, doc := range docs[start:end] {
+			texts = append(texts, doc.Text)
+		}
+		vectors, err := embedder.Embed(ctx, texts)
+		if err != nil {
+			return nil, fmt.Errorf("retrieval: could not embed documents %d-%d: %v", start, end, err)
+		}
+		if len(vectors) != len(texts) {
+			return nil, fmt.Errorf("retrieval: got %d vectors for %d documents", len(vectors), len(texts))
+		}
+		for i, doc := range docs[start:end] {
+			index.Add(doc, vectors[i])
+		}
+	}
+	return index, nil
+}
+
+// Add appends the document, a graph built before no longer covers all entries
+// and is dropped.
+func (ix *VectorIndex) Add(doc Document, vector []float32) {
+	ix.Entries = append(ix.Entries, vectorEntry{Document: doc, Vector: vector})
+	ix.Graph = nil
+}
+
+// Matches reports whether the index was built by model from exactly these
+// documents with the same metadata, so a persisted index can be reused
+// instead of embedding again.
+func (ix *VectorIndex) Matches(model string, docs []Document) bool {
+	if ix.Model != model || len(ix.Entries) != len(docs) {
+		return false
+	}
+	for i, doc := range docs {
+		entry := ix.Entries[i].Document
+		if entry.ID != doc.ID || entry.Text != doc.Text || !maps.Equal(entry.Metadata, doc.Metadata) {
+			return false
+		}
+	}
+	return true
+}
+
+// Search returns up to k documents most similar to the vector, using the HNSW
+// graph when it was built.
+func (ix *VectorIndex) Search(vector []float32, k int) []Hit {
+	return ix.SearchFiltered(vector, k, nil)
+}
+
+// SearchFiltered is Search over the documents with the metadata filters (see
+// MatchMetadata). Filtered searches compare the vector with every document.
+func (ix *VectorIndex) SearchFiltered(vector []float32, k int, filters map[string]string) []Hit {
+	if len(filters) == 0 && ix.Graph != nil && len(ix.Graph.Layers) == len(ix.Entries) {
+		return ix.Graph.search(ix, vector, k)
+	}
+	hits := make([]Hit, 0, len(ix.Entries))
+	for _, entry := range ix.Entries {
+		if !MatchMetadata(entry.Document, filters) {
+			continue
+		}
+		hits = append(hits, Hit{Document: entry.Document, Score: Cosine(vector, entry.Vector)})
+	}
+	slices.SortStableFunc(hits, func(a, b Hit) int { return cmp.Compare(b.Score, a.Score) })
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
+
+func (ix *VectorIndex) Save(path string) error {
+	content, err := json.Marshal(ix)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return fmt.Errorf("retrieval: could not save index %s: %v", path, err)
+	}
+	return nil
+}
+
+func LoadVectorIndex(path string) (*VectorIndex, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var index VectorIndex
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil, fmt.Errorf("retrieval: could not parse index %s: %v", path, err)
+	}
+	return &index, nil
+}
+
+func Cosine(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
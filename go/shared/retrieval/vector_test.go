@@ -0,0 +1,148 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+var reportDocs = []Document{
+	{ID: "a", Text: "Patrol zatrzymał nauczyciela w sektorze C4", Metadata: map[string]string{"sector": "C4"}},
+	{ID: "b", Text: "Naprawiono czujnik ruchu przy bramie zachodniej", Metadata: map[string]string{"sector": "A1"}},
+	{ID: "c", Text: "Zwierzyna leśna przebiegła obok ogrodzenia", Metadata: map[string]string{"sector": "B2"}},
+	{ID: "d", Text: "Czujnik ruchu w sektorze C4 wykrył nauczyciela", Metadata: map[string]string{"sector": "C4"}},
+}
+
+func TestHashEmbedder(t *testing.T) {
+	embedder := &HashEmbedder{Dimensions: 256}
+	vectors, err := embedder.Embed(context.Background(), []string{"czujnik ruchu", "Czujnik, ruchu!", "zwierzyna leśna", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != 4 || len(vectors[0]) != 256 {
+		t.Fatalf("got %d vectors of %d dimensions", len(vectors), len(vectors[0]))
+	}
+	var norm float64
+	for _, value := range vectors[0] {
+		norm += float64(value) * float64(value)
+	}
+	if math.Abs(norm-1) > 1e-6 {
+		t.Errorf("norm = %v, want 1", norm)
+	}
+	// case and punctuation do not change the vector
+	if similarity := Cosine(vectors[0], vectors[1]); math.Abs(similarity-1) > 1e-6 {
+		t.Errorf("similarity of the same words = %v", similarity)
+	}
+	if similarity := Cosine(vectors[0], vectors[2]); similarity > 0.5 {
+		t.Errorf("similarity of different words = %v", similarity)
+	}
+	for _, value := range vectors[3] {
+		if value != 0 {
+			t.Fatalf("vector of an empty text is not zero")
+		}
+	}
+}
+
+func TestVectorIndexSearch(t *testing.T) {
+	ctx := context.Background()
+	embedder := &HashEmbedder{Dimensions: 512}
+	index, err := BuildVectorIndex(ctx, embedder, "hash:512", reportDocs, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !index.Matches("hash:512", reportDocs) || index.Matches("hash:1024", reportDocs) {
+		t.Errorf("Matches does not compare the model")
+	}
+	query, err := embedder.Embed(ctx, []string{"czujnik ruchu przy bramie"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits := index.Search(query[0], 2); len(hits) != 2 || hits[0].ID != "b" {
+		t.Errorf("Search = %v, want b first", hits)
+	}
+	hits := index.SearchFiltered(query[0], 5, map[string]string{"sector": "C4"})
+	if len(hits) != 2 || hits[0].ID != "d" || hits[1].ID != "a" {
+		t.Errorf("SearchFiltered = %v, want d and a", hits)
+	}
+}
+
+func randomVectors(random *rand.Rand, n int, dimensions int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dimensions)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(random.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+func TestHNSWRecall(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	index := NewVectorIndex("random")
+	for i, vector := range randomVectors(random, 1000, 32) {
+		index.Add(Document{ID: fmt.Sprint(i)}, vector)
+	}
+	queries := randomVectors(random, 50, 32)
+
+	const k = 10
+	var exact [][]Hit
+	for _, query := range queries {
+		exact = append(exact, index.Search(query, k))
+	}
+	index.BuildHNSW(16, 64, 1)
+	found := 0
+	for i, query := range queries {
+		approximate := make(map[string]bool)
+		for _, hit := range index.Search(query, k) {
+			approximate[hit.ID] = true
+		}
+		for _, hit := range exact[i] {
+			if approximate[hit.ID] {
+				found++
+			}
+		}
+	}
+	if recall := float64(found) / float64(len(queries)*k); recall < 0.95 {
+		t.Errorf("recall = %.3f, want at least 0.95", recall)
+	}
+}
+
+func TestHNSWPersistence(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	index := NewVectorIndex("random")
+	for i, vector := range randomVectors(random, 200, 16) {
+		index.Add(Document{ID: fmt.Sprint(i)}, vector)
+	}
+	index.BuildHNSW(8, 32, 1)
+
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := index.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadVectorIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Graph == nil {
+		t.Fatal("graph was not saved")
+	}
+	query := randomVectors(random, 1, 16)[0]
+	want, got := index.Search(query, 5), loaded.Search(query, 5)
+	for i := range want {
+		if got[i].ID != want[i].ID {
+			t.Fatalf("loaded index found %v, want %v", got, want)
+		}
+	}
+
+	loaded.Add(Document{ID: "new"}, query)
+	if loaded.Graph != nil {
+		t.Error("Add kept a graph which does not cover the new entry")
+	}
+	if hits := loaded.Search(query, 1); hits[0].ID != "new" {
+		t.Errorf("Search after Add = %v, want new", hits)
+	}
+}
@@ -0,0 +1,137 @@
+package review
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"shared/media"
+	"slices"
+	"unicode/utf8"
+)
+
+const previewLimit = 4000
+
+var pageTemplate = template.Must(template.New("review").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Review queue</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; }
+.item { border: 1px solid #ccc; border-radius: 4px; padding: 1em; margin-bottom: 1.5em; }
+pre { white-space: pre-wrap; background: #f6f6f6; padding: .5em; max-height: 20em; overflow: auto; }
+img { max-width: 100%; max-height: 30em; }
+.meta { color: #555; }
+</style>
+</head>
+<body>
+<h1>Review queue ({{len .}} pending)</h1>
+{{if not .}}<p>Nothing to review, you can close this page.</p>{{end}}
+{{range .}}
+<div class="item">
+<h2>{{.ID}}</h2>
+{{if .Image}}<img src="/file?id={{.ID}}" alt="{{.ID}}">{{end}}
+{{if .Audio}}<audio controls src="/file?id={{.ID}}"></audio>{{end}}
+{{if .Preview}}<pre>{{.Preview}}</pre>{{end}}
+{{if .Suggestion}}<p class="meta">Suggestion: <b>{{.Suggestion}}</b>{{if .Confidence}} (confidence {{printf "%.2f" .Confidence}}){{end}}</p>{{end}}
+{{if .Evidence}}<p class="meta">Evidence: <q>{{.Evidence}}</q></p>{{end}}
+{{if .Reason}}<p class="meta">Reason: {{.Reason}}</p>{{end}}
+<form method="post" action="/decide">
+<input type="hidden" name="id" value="{{.ID}}">
+{{if .Acceptable}}<button name="label" value="{{.Suggestion}}">Accept {{.Suggestion}}</button>{{end}}
+<select name="override">{{range .Labels}}<option>{{.}}</option>{{end}}</select>
+<button name="action" value="override">Override</button>
+</form>
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+type pageItem struct {
+	Item
+	Preview string
+	Image   bool
+	Audio   bool
+	// Acceptable is true when the suggestion is one of the allowed labels.
+	Acceptable bool
+}
+
+// Handler serves the review page on /, the reviewed files on /file and
+// accepts the decisions posted to /decide.
+func (s *Store) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleList)
+	mux.HandleFunc("GET /file", s.handleFile)
+	mux.HandleFunc("POST /decide", s.handleDecide)
+	return mux
+}
+
+// Serve starts the review UI on addr in the background.
+func (s *Store) Serve(addr string) {
+	go func() {
+		if err := http.ListenAndServe(addr, s.Handler()); err != nil {
+			log.Printf("review: server stopped: %v", err)
+		}
+	}()
+}
+
+func (s *Store) handleList(w http.ResponseWriter, r *http.Request) {
+	var items []pageItem
+	for _, item := range s.Pending() {
+		page := pageItem{Item: item, Preview: item.Text}
+		page.Acceptable = item.Suggestion != "" && (len(item.Labels) == 0 || slices.Contains(item.Labels, item.Suggestion))
+		if item.Path != "" {
+			if data, err := os.ReadFile(item.Path); err == nil {
+				mime := media.Detect(data)
+				page.Image = media.IsImage(mime)
+				page.Audio = media.IsAudio(mime)
+				if page.Preview == "" && !page.Image && !page.Audio && utf8.Valid(data) {
+					page.Preview = string(data)
+				}
+			}
+		}
+		if len(page.Preview) > previewLimit {
+			cut := previewLimit
+			for cut > 0 && !utf8.RuneStart(page.Preview[cut]) {
+				cut--
+			}
+			page.Preview = page.Preview[:cut] + "..."
+		}
+		items = append(items, page)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pageTemplate.Execute(w, items); err != nil {
+		log.Printf("review: could not render page: %v", err)
+	}
+}
+
+func (s *Store) handleFile(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	item, ok := s.items[r.URL.Query().Get("id")]
+	s.mu.Unlock()
+	if !ok || item.Path == "" {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := os.ReadFile(item.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", media.Detect(data))
+	w.Write(data)
+}
+
+func (s *Store) handleDecide(w http.ResponseWriter, r *http.Request) {
+	label := r.FormValue("label")
+	if r.FormValue("action") == "override" {
+		label = r.FormValue("override")
+	}
+	if err := s.Decide(r.FormValue("id"), label); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
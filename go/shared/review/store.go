@@ -0,0 +1,202 @@
+package review
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Item is a model output waiting for a human decision. Path points to the
+// reviewed file, Text is used for items which are not backed by a file.
+type Item struct {
+	ID         string    `json:"id"`
+	Path       string    `json:"path,omitempty"`
+	Text       string    `json:"text,omitempty"`
+	Hash       string    `json:"hash"`
+	Suggestion string    `json:"suggestion"`
+	Confidence float64   `json:"confidence,omitempty"`
+	Evidence   string    `json:"evidence,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Labels     []string  `json:"labels"`
+	QueuedAt   time.Time `json:"queued_at"`
+}
+
+// Decision is the reviewed label of an item. Decisions are kept as labeled
+// data, Accepted tells whether the reviewer agreed with the model.
+type Decision struct {
+	ID         string    `json:"id"`
+	Path       string    `json:"path,omitempty"`
+	Text       string    `json:"text,omitempty"`
+	Hash       string    `json:"hash"`
+	Label      string    `json:"label"`
+	Suggestion string    `json:"suggestion"`
+	Accepted   bool      `json:"accepted"`
+	ReviewedAt time.Time `json:"reviewed_at"`
+}
+
+// Store keeps the queue (queue.jsonl) and the decisions (decisions.jsonl) in
+// dir. Both files are append only, the last line of an ID wins.
+type Store struct {
+	mu        sync.Mutex
+	dir       string
+	items     map[string]Item
+	order     []string
+	decisions map[string]Decision
+	changed   chan struct{}
+}
+
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("review: could not create %s: %v", dir, err)
+	}
+	s := &Store{
+		dir:       dir,
+		items:     make(map[string]Item),
+		decisions: make(map[string]Decision),
+		changed:   make(chan struct{}, 1),
+	}
+	err := readLines(filepath.Join(dir, "queue.jsonl"), func(item Item) {
+		if _, ok := s.items[item.ID]; !ok {
+			s.order = append(s.order, item.ID)
+		}
+		s.items[item.ID] = item
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = readLines(filepath.Join(dir, "decisions.jsonl"), func(decision Decision) {
+		s.decisions[decision.ID] = decision
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add queues the item unless it was already decided for the same content.
+func (s *Store) Add(item Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if decision, ok := s.decisions[item.ID]; ok && decision.Hash == item.Hash {
+		return nil
+	}
+	if item.QueuedAt.IsZero() {
+		item.QueuedAt = time.Now()
+	}
+	if err := appendLine(filepath.Join(s.dir, "queue.jsonl"), item); err != nil {
+		return err
+	}
+	if _, ok := s.items[item.ID]; !ok {
+		s.order = append(s.order, item.ID)
+	}
+	s.items[item.ID] = item
+	return nil
+}
+
+// Pending returns the queued items without a decision, in the queue order.
+func (s *Store) Pending() []Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []Item
+	for _, id := range s.order {
+		item := s.items[id]
+		if decision, ok := s.decisions[id]; !ok || decision.Hash != item.Hash {
+			pending = append(pending, item)
+		}
+	}
+	return pending
+}
+
+// Decision returns the human decision made for the content with the given hash.
+func (s *Store) Decision(id string, hash string) (Decision, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	decision, ok := s.decisions[id]
+	return decision, ok && decision.Hash == hash
+}
+
+// Decide records the label chosen by the reviewer.
+func (s *Store) Decide(id string, label string) error {
+	if label == "" {
+		return fmt.Errorf("review: no label chosen for %s", id)
+	}
+	s.mu.Lock()
+	item, ok := s.items[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("review: unknown item %s", id)
+	}
+	if len(item.Labels) > 0 && !slices.Contains(item.Labels, label) {
+		s.mu.Unlock()
+		return fmt.Errorf("review: label %s is not allowed for %s", label, id)
+	}
+	decision := Decision{
+		ID:         id,
+		Path:       item.Path,
+		Text:       item.Text,
+		Hash:       item.Hash,
+		Label:      label,
+		Suggestion: item.Suggestion,
+		Accepted:   label == item.Suggestion,
+		ReviewedAt: time.Now(),
+	}
+	if err := appendLine(filepath.Join(s.dir, "decisions.jsonl"), decision); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.decisions[id] = decision
+	s.mu.Unlock()
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// WaitUntilReviewed blocks until there are no pending items or ctx is done.
+func (s *Store) WaitUntilReviewed(ctx context.Context) error {
+	for len(s.Pending()) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.changed:
+		}
+	}
+	return nil
+}
+
+func readLines[T any](path string, apply func(T)) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("review: could not read %s: %v", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	for decoder.More() {
+		var value T
+		if err := decoder.Decode(&value); err != nil {
+			return fmt.Errorf("review: broken line in %s: %v", path, err)
+		}
+		apply(value)
+	}
+	return nil
+}
+
+func appendLine(path string, value any) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("review: could not open %s: %v", path, err)
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(value)
+}
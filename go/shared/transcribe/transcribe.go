@@ -0,0 +1,203 @@
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"shared/batch"
+	"shared/media"
+	"strings"
+)
+
+// ArtifactSuffix is appended to the source file name, e.g. report.mp3.transcript.txt.
+const ArtifactSuffix = ".transcript.txt"
+
+type SpeechToText interface {
+	Transcribe(ctx context.Context, name string, data []byte) (string, error)
+}
+
+type OCR interface {
+	ExtractText(ctx context.Context, name string, mime string, data []byte) (string, error)
+}
+
+// OCRFunc adapts a function (e.g. a call to a vision model) to OCR.
+type OCRFunc func(ctx context.Context, name string, mime string, data []byte) (string, error)
+
+func (f OCRFunc) ExtractText(ctx context.Context, name string, mime string, data []byte) (string, error) {
+	return f(ctx, name, mime, data)
+}
+
+// OpenAITranscriber calls an OpenAI compatible /audio/transcriptions endpoint,
+// BaseURL may point to a local Whisper server or a mock.
+type OpenAITranscriber struct {
+	BaseURL  string
+	APIKey   string
+	Model    string
+	Language string
+	Client   *http.Client
+}
+
+func (t *OpenAITranscriber) Transcribe(ctx context.Context, name string, data []byte) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fields := map[string]string{"model": t.Model, "response_format": "json"}
+	if t.Language != "" {
+		fields["language"] = t.Language
+	}
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			return "", err
+		}
+	}
+	part, err := writer.CreateFormFile("file", filepath.Base(name))
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(t.BaseURL, "/")+"/audio/transcriptions", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if t.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.APIKey)
+	}
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcription failed | %d | %s", resp.StatusCode, string(respBody))
+	}
+
+	var transcription struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(respBody, &transcription); err != nil {
+		return "", fmt.Errorf("could not decode transcription: %v", err)
+	}
+	return transcription.Text, nil
+}
+
+// Preprocessor turns audio and images into text once and keeps the text next
+// to the source file, so later runs (and other tasks) read the cached artifact.
+type Preprocessor struct {
+	STT SpeechToText
+	OCR OCR
+}
+
+// NewPreprocessorFromEnv transcribes Polish audio with the OpenAI compatible
+// endpoint of STT_BASE_URL and STT_MODEL (OpenAI whisper-1 by default). Images
+// are scaled to limits and passed to read after waiting for the limiter of the
+// provider of limits.
+func NewPreprocessorFromEnv(limits media.Limits, limiter *batch.Limiter, read func(ctx context.Context, img *media.Image) (string, error)) *Preprocessor {
+	baseURL := os.Getenv("STT_BASE_URL")
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	sttModel := os.Getenv("STT_MODEL")
+	if sttModel == "" {
+		sttModel = "whisper-1"
+	}
+
+	return &Preprocessor{
+		STT: &OpenAITranscriber{
+			BaseURL:  baseURL,
+			APIKey:   os.Getenv("OPENAI_API_KEY"),
+			Model:    sttModel,
+			Language: "pl",
+		},
+		OCR: OCRFunc(func(ctx context.Context, name string, mime string, data []byte) (string, error) {
+			img, err := media.PrepareImage(data, limits)
+			if err != nil {
+				return "", err
+			}
+			if err := limiter.Wait(ctx, limits.Provider); err != nil {
+				return "", err
+			}
+			return read(ctx, img)
+		}),
+	}
+}
+
+// IsArtifact reports whether path is a cached text artifact, directory scans
+// should skip such files.
+func IsArtifact(path string) bool {
+	return strings.HasSuffix(path, ArtifactSuffix)
+}
+
+func ArtifactPath(path string) string {
+	return path + ArtifactSuffix
+}
+
+// Text returns the text of an audio or image file. ok is false for other file
+// types, which the caller should handle on its own.
+func (p *Preprocessor) Text(ctx context.Context, path string, data []byte) (text string, ok bool, err error) {
+	mime := media.Detect(data)
+	if !media.IsAudio(mime) && !media.IsImage(mime) {
+		return "", false, nil
+	}
+
+	artifact := ArtifactPath(path)
+	if fresh(artifact, path) {
+		cached, err := os.ReadFile(artifact)
+		if err == nil {
+			return string(cached), true, nil
+		}
+	}
+
+	switch {
+	case media.IsAudio(mime) && p.STT != nil:
+		text, err = p.STT.Transcribe(ctx, path, data)
+	case media.IsImage(mime) && p.OCR != nil:
+		text, err = p.OCR.ExtractText(ctx, path, mime, data)
+	default:
+		return "", false, nil
+	}
+	if err != nil {
+		return "", true, fmt.Errorf("could not extract text from %s: %v", path, err)
+	}
+
+	text = strings.TrimSpace(text)
+	if err := os.WriteFile(artifact, []byte(text), 0o644); err != nil {
+		log.Printf("warning: could not cache text of %s: %v", path, err)
+	}
+	return text, true, nil
+}
+
+// fresh reports whether the artifact exists and is not older than the source.
+func fresh(artifact string, source string) bool {
+	artifactInfo, err := os.Stat(artifact)
+	if err != nil {
+		return false
+	}
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return true
+	}
+	return !artifactInfo.ModTime().Before(sourceInfo.ModTime())
+}